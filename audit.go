@@ -0,0 +1,221 @@
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+)
+
+// AuditKind is the kind of operation reported to an AuditHook.
+type AuditKind string
+
+const (
+	AuditCommand AuditKind = "command"
+	AuditFile    AuditKind = "file"
+	AuditEnv     AuditKind = "env"
+)
+
+// AuditEvent describes an operation performed by an expression.
+type AuditEvent struct {
+	Kind AuditKind
+	// Operation is the function performing the operation, such as "$", "readFile" or "env".
+	Operation string
+	// Target is the command, the file path or the environment variable name, or "*" when an expression reads
+	// the whole environment, such as with `keys(env)` or `"NAME" in env`.
+	Target string
+	// Expression is the expression the operation originates from, if known.
+	Expression string
+	Start      time.Time
+
+	// Duration, ResultSize and Err are only set once the operation completed. ResultSize is the size of the
+	// command output, of the value read or the length of the list returned.
+	Duration   time.Duration
+	ResultSize int
+	Err        error
+}
+
+// AuditHook is notified of each command, file helper call and environment variable access performed by
+// expressions, for instance to write audit logs or enforce policies.
+type AuditHook interface {
+	// Authorize is called before an operation is performed. Returning an error prevents the operation
+	// and fails the evaluation.
+	Authorize(event AuditEvent) error
+	// Record is called once an authorized operation completed.
+	Record(event AuditEvent)
+}
+
+// WithAuditHook reports the operations performed by expressions to the hook.
+func WithAuditHook(hook AuditHook) Option {
+	return func(s *session) {
+		s.auditHook = hook
+	}
+}
+
+// audit performs an operation, reporting it to the audit hook, if any. The operation returns the size
+// of its result.
+func (s *session) audit(event AuditEvent, op func() (int, error)) error {
+	if s.auditHook == nil {
+		_, err := op()
+		return err
+	}
+
+	event.Target = s.redact(event.Target)
+	event.Expression = s.redact(event.Expression)
+	event.Start = time.Now()
+	if err := s.auditHook.Authorize(event); err != nil {
+		return fmt.Errorf("%s %s(%q) denied: %w", event.Kind, event.Operation, event.Target, err)
+	}
+	size, err := op()
+	event.Duration = time.Since(event.Start)
+	event.ResultSize = size
+	event.Err = s.newEvaluation().redactError(err)
+	s.auditHook.Record(event)
+	return err
+}
+
+// forExpression prepares data for the evaluation of an expression, after checking the environment variables
+// it requires. It returns the options evaluating the namespaces and `$env` and, when needed, a copy of the data
+// with the secrets unwrapped, the `reveal` function bound to the evaluation, the `requireEnv` function reusing
+// the variables checked and, when auditing, the command functions bound to the expression and the options
+// routing environment variable accesses through the audit hook.
+func (s *session) forExpression(
+	data map[string]interface{}, ex string, ev *evaluation,
+) (map[string]interface{}, []expr.Option, error) {
+	required, err := s.checkRequiredEnv(ex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := s.namespaceOptions(ex)
+	if s.auditHook != nil || len(s.secretVars) > 0 || s.secretReveal || len(required) > 0 {
+		bound := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			bound[k] = v
+		}
+		s.unwrapSecretVars(bound)
+		s.setBuiltin(bound, "reveal", ev.reveal)
+		data = bound
+	}
+	opts = append(opts, s.dataOptions(data, ex)...)
+	if s.auditHook != nil {
+		s.setFunctions(data, ex)
+	}
+	if len(required) > 0 {
+		s.setBuiltin(data, "requireEnv", func(name string) (string, error) {
+			if value, ok := required[name]; ok {
+				return value, nil
+			}
+			return s.requireEnv(ex, name)
+		})
+	}
+	if s.auditHook == nil {
+		return data, opts, nil
+	}
+
+	return data, append(opts,
+		expr.Function(envLookupFunction, func(params ...interface{}) (interface{}, error) {
+			if len(params) != 1 {
+				return nil, fmt.Errorf("%s() takes 1 argument, got %d", envLookupFunction, len(params))
+			}
+			return s.auditedEnvVar(ex, fmt.Sprintf("%v", params[0]))
+		}),
+		expr.Function(envMapFunction, func(...interface{}) (interface{}, error) {
+			return s.auditedEnv(ex)
+		}, new(func() map[string]string)),
+		expr.Patch(envAccessPatcher{name: s.nameOf("env")}),
+	), nil
+}
+
+// auditedEnvVar returns the value of a variable of the env map, reporting the access to the audit hook.
+func (s *session) auditedEnvVar(ex, key string) (interface{}, error) {
+	var value interface{}
+	event := AuditEvent{Kind: AuditEnv, Operation: "env", Target: key, Expression: ex}
+	err := s.audit(event, func() (int, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if v, ok := s.env[key]; ok {
+			value = v
+			return len(v), nil
+		}
+		return 0, nil
+	})
+	return value, err
+}
+
+// auditedEnv returns the whole env map, reporting the access to the audit hook.
+func (s *session) auditedEnv(ex string) (map[string]string, error) {
+	var env map[string]string
+	event := AuditEvent{Kind: AuditEnv, Operation: "env", Target: "*", Expression: ex}
+	err := s.audit(event, func() (int, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		env = s.env
+		return len(env), nil
+	})
+	return env, err
+}
+
+// envLookupFunction is the function replacing accesses to environment variables when auditing, and
+// envMapFunction the one replacing other uses of the whole environment. They are not named `$env`, which
+// expressions use for the whole data.
+const (
+	envLookupFunction = "$envVar"
+	envMapFunction    = "$envMap"
+)
+
+// envAccessPatcher replaces `env.NAME` and `env[name]` with calls to the environment lookup function, and
+// any other use of `env`, including `$env.env`, with a call to the environment map function, where name is the
+// name of `env` in the data. The tree is walked depth first, so `env` is replaced before the member accesses
+// using it. It runs after the data patcher, so `$env` is already a call to the data function.
+type envAccessPatcher struct {
+	name string
+}
+
+func (p envAccessPatcher) Visit(node *ast.Node) {
+	if p.name == "" {
+		return
+	}
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if n.Value == p.name {
+			ast.Patch(node, &ast.CallNode{Callee: &ast.IdentifierNode{Value: envMapFunction}})
+		}
+	case *ast.MemberNode:
+		call, ok := n.Node.(*ast.CallNode)
+		if !ok {
+			return
+		}
+		if property, ok := n.Property.(*ast.StringNode); ok && property.Value == p.name && isDataCall(call) {
+			ast.Patch(node, &ast.CallNode{Callee: &ast.IdentifierNode{Value: envMapFunction}})
+		} else if isEnvMapCall(call) {
+			ast.Patch(node, &ast.CallNode{
+				Callee:    &ast.IdentifierNode{Value: envLookupFunction},
+				Arguments: []ast.Node{n.Property},
+			})
+		}
+	}
+}
+
+func isDataCall(call *ast.CallNode) bool {
+	ident, ok := call.Callee.(*ast.IdentifierNode)
+	return ok && ident.Value == dataFunction && len(call.Arguments) == 0
+}
+
+func isEnvMapCall(call *ast.CallNode) bool {
+	ident, ok := call.Callee.(*ast.IdentifierNode)
+	return ok && ident.Value == envMapFunction && len(call.Arguments) == 0
+}
+
+// resultSize returns the size reported to the audit hook for the result of a file helper.
+func resultSize(result interface{}) int {
+	v := reflect.ValueOf(result)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len()
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,174 @@
+package expression_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+type testAuditHook struct {
+	mu     sync.Mutex
+	events []expression.AuditEvent
+}
+
+func (h *testAuditHook) Authorize(event expression.AuditEvent) error {
+	if event.Kind == expression.AuditCommand && strings.HasPrefix(event.Target, "rm ") {
+		return errors.New("rm is not allowed")
+	}
+	if event.Kind == expression.AuditEnv && event.Target == "SECRET" {
+		return errors.New("SECRET is not allowed")
+	}
+	return nil
+}
+
+func (h *testAuditHook) Record(event expression.AuditEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func TestAuditHook(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(testFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	hook := &testAuditHook{}
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"NAME": "world", "SECRET": "token"},
+		[]expression.Option{expression.WithAuditHook(hook)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	ex := `$("echo hello") + " " + env.NAME + " " + readFile("` + testFile + `") + string(env["MISSING"] == nil)`
+	result, err := expression.EvaluateString(ex, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "hello world contenttrue" {
+		t.Errorf("expected %q, got %q", "hello world contenttrue", result)
+	}
+
+	expected := []struct {
+		kind      expression.AuditKind
+		operation string
+		target    string
+		size      int
+	}{
+		{expression.AuditCommand, "$", "echo hello", 6},
+		{expression.AuditEnv, "env", "NAME", 5},
+		{expression.AuditFile, "readFile", testFile, 7},
+		{expression.AuditEnv, "env", "MISSING", 0},
+	}
+	if len(hook.events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), hook.events)
+	}
+	for i, e := range expected {
+		event := hook.events[i]
+		if event.Kind != e.kind || event.Operation != e.operation || event.Target != e.target || event.ResultSize != e.size {
+			t.Errorf("expected event %+v, got %+v", e, event)
+		}
+		if event.Expression != ex || event.Start.IsZero() || event.Err != nil {
+			t.Errorf("expected expression, start time and no error, got %+v", event)
+		}
+	}
+
+	t.Run("denied operations", func(t *testing.T) {
+		for _, ex := range []string{`$("rm -rf /tmp/nothing")`, `env.SECRET`} {
+			_, err := expression.Evaluate(ex, data)
+			if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+				t.Errorf("expected %s to be denied, got %v", ex, err)
+			}
+		}
+	})
+
+	t.Run("environment through $env", func(t *testing.T) {
+		for _, ex := range []string{`$env.env.NAME`, `$env["env"]["NAME"]`, `$env?.env?.NAME`} {
+			hook.events = nil
+			result, err := expression.Evaluate(ex, data)
+			if err != nil {
+				t.Fatalf("expected no error evaluating %s, got %v", ex, err)
+			}
+			if result != "world" {
+				t.Errorf("expected %s to be %q, got %v", ex, "world", result)
+			}
+			if len(hook.events) != 1 || hook.events[0].Kind != expression.AuditEnv || hook.events[0].Target != "NAME" {
+				t.Errorf("expected %s to report reading NAME, got %+v", ex, hook.events)
+			}
+		}
+		_, err := expression.Evaluate(`$env.env.SECRET`, data)
+		if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+			t.Errorf("expected $env.env.SECRET to be denied, got %v", err)
+		}
+	})
+
+	t.Run("direct calls of the environment functions", func(t *testing.T) {
+		for ex, expected := range map[string]string{
+			`$envVar()`:         "takes 1 argument, got 0",
+			`$envVar("a", "b")`: "takes 1 argument, got 2",
+			`$envMap(1)`:        "too many arguments",
+			`$env()`:            "not callable",
+		} {
+			if _, err := expression.Evaluate(ex, data); err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected %s to fail with %q, got %v", ex, expected, err)
+			}
+		}
+	})
+
+	t.Run("whole environment", func(t *testing.T) {
+		tests := []struct {
+			expr     string
+			expected interface{}
+		}{
+			{`"NAME" in env`, true},
+			{`len(keys(env))`, 2},
+			{`sort(values(env))[1]`, "world"},
+			{`getenv("NAME") + string(len(env))`, "world2"},
+			{`len($env.env)`, 2},
+			{`len(keys($env["env"]))`, 2},
+			{`$env.env.NAME + string(len(get($env, "env")))`, "world2"},
+		}
+		for _, test := range tests {
+			hook.events = nil
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error evaluating %s, got %v", test.expr, err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %s to be %v, got %v", test.expr, test.expected, result)
+			}
+			last := hook.events[len(hook.events)-1]
+			if last.Kind != expression.AuditEnv || last.Target != "*" || last.ResultSize != 2 {
+				t.Errorf("expected %s to report reading the whole environment, got %+v", test.expr, hook.events)
+			}
+		}
+	})
+
+	t.Run("template operations", func(t *testing.T) {
+		hook.events = nil
+		tmpl := expression.NewTemplate("test", data)
+		if err := tmpl.Parse(`{{ $("echo " + env.NAME) }}`); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		result, err := tmpl.ExecuteToString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != "world" {
+			t.Errorf("expected 'world', got '%s'", result)
+		}
+		if len(hook.events) != 2 || hook.events[0].Kind != expression.AuditEnv ||
+			hook.events[1].Target != "echo world" || hook.events[1].Expression != `$("echo " + env.NAME)` {
+			t.Errorf("unexpected template events %+v", hook.events)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package expression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// builtins lists the variables and functions set in the data by BuildData and NewData.
+var builtins = []string{
+	"os", "arch", "env",
+	"$", "run", "parallel", "$json", "$yaml", "$lines", "$fields",
+	"getenv", "hasEnv", "requireEnv",
+	"git", "host", "user",
+	"reveal",
+}
+
+// namespaceBuiltins lists the built-in namespaces, which are only set when enabled by an option.
+var namespaceBuiltins = []string{"git", "host", "user"}
+
+// NewData constructs a Data object from options, like BuildDataWithOptions. Unlike BuildData, variables
+// set with WithVars cannot silently replace built-ins: a variable named like a built-in is an error, unless
+// the built-in is renamed with WithBuiltinName or disabled with WithoutBuiltins.
+//
+//	data, err := expression.NewData(ctx,
+//		expression.WithVars(map[string]interface{}{"os": "ubuntu"}),
+//		expression.WithEnv(map[string]string{"NAME": "world"}),
+//		expression.WithBuiltinName("os", "goos"),
+//		expression.WithoutShell(),
+//	)
+func NewData(ctx context.Context, opts ...Option) (Data, error) {
+	return newSession(ctx, opts).build(true)
+}
+
+// WithVars adds variables to the data. Variables of later calls override those of earlier ones. Keys can be
+// paths such as `app.servers[0].name` building nested maps and lists, as for BuildData.
+func WithVars(vars map[string]interface{}) Option {
+	return func(s *session) {
+		s.optionErrs = append(s.optionErrs, setKeyPaths(s.vars, vars)...)
+	}
+}
+
+// WithEnv adds environment variables to `env` and to the environment of commands. Variables of later calls
+// override those of earlier ones, and variables of the env map passed to BuildDataWithOptions override all
+// of them.
+func WithEnv(env map[string]string) Option {
+	return func(s *session) {
+		maps.Copy(s.env, env)
+	}
+}
+
+// WithShell enables the functions running shell commands (`$`, `run`, `parallel`, `$json`, `$yaml`,
+// `$lines` and `$fields`), which are enabled by default.
+func WithShell() Option {
+	return func(s *session) {
+		s.noShell = false
+	}
+}
+
+// WithoutShell disables the functions running shell commands, so that expressions cannot run commands.
+func WithoutShell() Option {
+	return func(s *session) {
+		s.noShell = true
+	}
+}
+
+// WithBuiltinName sets a built-in variable or function under another name, for instance to free its name
+// for a variable.
+func WithBuiltinName(builtin, name string) Option {
+	return func(s *session) {
+		if !slices.Contains(builtins, builtin) {
+			s.optionErrs = append(s.optionErrs, fmt.Errorf("unknown built-in %q", builtin))
+			return
+		}
+		if name == "" {
+			s.optionErrs = append(s.optionErrs, fmt.Errorf("empty name for built-in %q", builtin))
+			return
+		}
+		s.builtinNames[builtin] = name
+	}
+}
+
+// WithoutBuiltins removes built-in variables or functions from the data.
+func WithoutBuiltins(builtinNames ...string) Option {
+	return func(s *session) {
+		for _, builtin := range builtinNames {
+			if !slices.Contains(builtins, builtin) {
+				s.optionErrs = append(s.optionErrs, fmt.Errorf("unknown built-in %q", builtin))
+				continue
+			}
+			s.builtinNames[builtin] = ""
+		}
+	}
+}
+
+func newSession(ctx context.Context, opts []Option) *session {
+	s := &session{
+		ctx:          ctx,
+		env:          make(map[string]string),
+		vars:         make(map[string]interface{}),
+		builtinNames: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// build returns the data of the session. When strict, variables named like built-ins are reported as errors
+// instead of being replaced by the built-ins.
+func (s *session) build(strict bool) (Data, error) {
+	vars := s.vars
+	if len(s.dataSources) > 0 {
+		loaded, err := loadDataSources(s.dataSources)
+		if err != nil {
+			return nil, err
+		}
+		deepMerge(loaded, s.vars)
+		vars = loaded
+	}
+
+	errs := s.optionErrs
+	errs = append(errs, s.checkBuiltinNames()...)
+	if strict {
+		errs = append(errs, s.checkVarNames(vars)...)
+	}
+	if len(s.schema) > 0 {
+		if err := s.schema.apply(vars); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := s.loadEnvironment(); err != nil {
+		return nil, err
+	}
+	s.registerSecrets(vars)
+	if s.recorder != nil {
+		s.recordEnv(s.env)
+	}
+
+	data := make(map[string]interface{}, len(vars)+len(builtins)+1)
+	maps.Copy(data, vars)
+	s.setFunctions(data, "")
+	data[sessionKey] = s
+	return data, nil
+}
+
+// checkBuiltinNames reports built-ins renamed to the name of another built-in.
+func (s *session) checkBuiltinNames() []error {
+	var errs []error
+	used := make(map[string]string)
+	for _, builtin := range builtins {
+		name := s.nameOf(builtin)
+		if name == "" {
+			continue
+		}
+		if other, ok := used[name]; ok {
+			errs = append(errs, fmt.Errorf("built-ins %q and %q are both named %q", other, builtin, name))
+			continue
+		}
+		used[name] = builtin
+	}
+	return errs
+}
+
+// checkVarNames reports variables named like a built-in.
+func (s *session) checkVarNames(vars map[string]interface{}) []error {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if name == sessionKey {
+			errs = append(errs, fmt.Errorf("variable name %q is reserved", name))
+		} else if s.builtinOf(name) != "" {
+			errs = append(errs, fmt.Errorf(
+				"variable %q collides with the built-in of the same name, rename it with WithBuiltinName or "+
+					"disable it with WithoutBuiltins", name))
+		}
+	}
+	return errs
+}
+
+// nameOf returns the name of a built-in in the data, or an empty string if it is disabled.
+func (s *session) nameOf(builtin string) string {
+	if s.noShell && isShellBuiltin(builtin) {
+		return ""
+	}
+	if slices.Contains(namespaceBuiltins, builtin) && s.namespaces[builtin] == nil {
+		return ""
+	}
+	if builtin == "reveal" && !s.secretReveal {
+		return ""
+	}
+	if name, ok := s.builtinNames[builtin]; ok {
+		return name
+	}
+	return builtin
+}
+
+// builtinOf returns the built-in set under a name in the data, or an empty string if there is none.
+func (s *session) builtinOf(name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, builtin := range builtins {
+		if s.nameOf(builtin) == name {
+			return builtin
+		}
+	}
+	return ""
+}
+
+// setBuiltin sets a built-in in the data under its name, unless it is disabled.
+func (s *session) setBuiltin(m map[string]interface{}, builtin string, value interface{}) {
+	if name := s.nameOf(builtin); name != "" {
+		m[name] = value
+	}
+}
+
+// isShellBuiltin reports whether a built-in runs shell commands.
+func isShellBuiltin(builtin string) bool {
+	return builtin == "run" || builtin == "parallel" || isCommandFunction(builtin)
+}
@@ -0,0 +1,214 @@
+package expression_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestNewData(t *testing.T) {
+	data, err := expression.NewData(
+		context.Background(),
+		expression.WithVars(map[string]interface{}{"name": "world", "count": 1}),
+		expression.WithVars(map[string]interface{}{"count": 2}),
+		expression.WithEnv(map[string]string{"GREETING": "hello"}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"variable", `name`, "world"},
+		{"overridden variable", `string(count)`, "2"},
+		{"env", `env.GREETING`, "hello"},
+		{"command", `$("echo $GREETING " + shellQuote(name))`, "hello world"},
+		{"built-in", `os != ""`, "true"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestNewDataBuiltinNames(t *testing.T) {
+	data, err := expression.NewData(
+		context.Background(),
+		expression.WithVars(map[string]interface{}{"os": "ubuntu", "env": "prod"}),
+		expression.WithBuiltinName("os", "goos"),
+		expression.WithBuiltinName("$", "sh"),
+		expression.WithoutBuiltins("env"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"variable replacing built-in", `os + "/" + env`, "ubuntu/prod"},
+		{"renamed variable", `goos != ""`, "true"},
+		{"renamed function", `sh("echo hi")`, "hi"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	if _, err := expression.Evaluate(`$("echo hi")`, data); err == nil {
+		t.Error("expected an error calling a renamed function by its original name")
+	}
+}
+
+func TestNewDataWithoutShell(t *testing.T) {
+	data, err := expression.NewData(context.Background(), expression.WithoutShell())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, ex := range []string{`$("echo hi")`, `run("echo", ["hi"])`, `parallel(["echo hi"])`, `$json("echo {}")`} {
+		if _, err := expression.Evaluate(ex, data); err == nil {
+			t.Errorf("expected an error evaluating %s without shell", ex)
+		}
+	}
+
+	data, err = expression.NewData(context.Background(), expression.WithoutShell(), expression.WithShell())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result, err := expression.EvaluateString(`$("echo hi")`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "hi" {
+		t.Errorf("expected %q, got %q", "hi", result)
+	}
+}
+
+func TestNewDataEnvVariable(t *testing.T) {
+	data, err := expression.NewData(
+		context.Background(), expression.WithVars(map[string]interface{}{"name": "world"}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{`$env.name`, "world"},
+		{`$env["name"]`, "world"},
+		{`"name" in $env`, "true"},
+		{`"\x00session" in $env`, "false"},
+		{`$env["\x00session"] == nil`, "true"},
+		{`any(keys($env), {# startsWith "\x00"})`, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+}
+
+func TestNewDataErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []expression.Option
+		expected []string
+	}{
+		{
+			name:     "reserved names",
+			opts:     []expression.Option{expression.WithVars(map[string]interface{}{"os": "ubuntu", "$": "x"})},
+			expected: []string{`variable "$" collides`, `variable "os" collides`},
+		},
+		{
+			name: "renamed to a variable",
+			opts: []expression.Option{
+				expression.WithVars(map[string]interface{}{"goos": "ubuntu"}),
+				expression.WithBuiltinName("os", "goos"),
+			},
+			expected: []string{`variable "goos" collides`},
+		},
+		{
+			name:     "renamed to another built-in",
+			opts:     []expression.Option{expression.WithBuiltinName("os", "arch")},
+			expected: []string{`built-ins "os" and "arch" are both named "arch"`},
+		},
+		{
+			name:     "unknown built-in",
+			opts:     []expression.Option{expression.WithBuiltinName("nope", "x"), expression.WithoutBuiltins("other")},
+			expected: []string{`unknown built-in "nope"`, `unknown built-in "other"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.NewData(context.Background(), test.opts...)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, expected := range test.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q, got %q", expected, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestTemplatePrefetchRenamedShell(t *testing.T) {
+	data, err := expression.NewData(
+		context.Background(),
+		expression.WithVars(map[string]interface{}{"$": "not a command"}),
+		expression.WithBuiltinName("$", "sh"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tmpl := expression.NewTemplate("test", data)
+	if err := tmpl.Parse(`{{sh("echo hi")}}`); err != nil {
+		t.Fatalf("expected no error parsing, got %v", err)
+	}
+	if err := tmpl.Prefetch(); err != nil {
+		t.Fatalf("expected no error prefetching, got %v", err)
+	}
+	result, err := tmpl.ExecuteToString()
+	if err != nil {
+		t.Fatalf("expected no error executing, got %v", err)
+	}
+	if result != "hi" {
+		t.Errorf("expected %q, got %q", "hi", result)
+	}
+}
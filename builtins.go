@@ -0,0 +1,607 @@
+package expression
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// WithPortableBuiltins makes commands use pure-Go implementations of common utilities instead of the
+// host binaries, so that expressions behave identically on hosts lacking coreutils. The following
+// commands are provided: cat, wc, grep, head, tail, ls, basename, dirname and which.
+// The `test` and `[` commands are always provided by the shell interpreter.
+func WithPortableBuiltins() Option {
+	return func(s *session) {
+		s.portableBuiltins = true
+	}
+}
+
+type builtinFunc func(hc interp.HandlerContext, args []string) error
+
+var portableBuiltins map[string]builtinFunc
+
+func init() {
+	// Assigned in init since `which` looks up the portable builtins.
+	portableBuiltins = map[string]builtinFunc{
+		"basename": builtinBasename,
+		"cat":      builtinCat,
+		"dirname":  builtinDirname,
+		"grep":     builtinGrep,
+		"head":     builtinHead,
+		"ls":       builtinLs,
+		"tail":     builtinTail,
+		"wc":       builtinWc,
+		"which":    builtinWhich,
+	}
+}
+
+// portableBuiltinsHandler is an interpreter exec middleware running the portable builtins.
+func portableBuiltinsHandler(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		fn, ok := portableBuiltins[args[0]]
+		if !ok {
+			return next(ctx, args)
+		}
+		hc := interp.HandlerCtx(ctx)
+		err := fn(hc, args[1:])
+		var exitStatus interp.ExitStatus
+		if err == nil || errors.As(err, &exitStatus) {
+			return err
+		}
+		fmt.Fprintf(hc.Stderr, "%s: %v\n", args[0], err)
+		return interp.NewExitStatus(2)
+	}
+}
+
+// builtinFlags parses the leading single-letter flags of a command. Flags listed in valueFlags
+// take a value, either attached (-n5) or as the next argument (-n 5).
+func builtinFlags(args []string, boolFlags, valueFlags string) (map[byte]string, []string, error) {
+	flags := make(map[byte]string)
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			return flags, args[1:], nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		args = args[1:]
+		for i := 1; i < len(arg); i++ {
+			switch {
+			case strings.IndexByte(boolFlags, arg[i]) >= 0:
+				flags[arg[i]] = ""
+			case strings.IndexByte(valueFlags, arg[i]) >= 0:
+				if i+1 < len(arg) {
+					flags[arg[i]] = arg[i+1:]
+				} else if len(args) > 0 {
+					flags[arg[i]] = args[0]
+					args = args[1:]
+				} else {
+					return nil, nil, fmt.Errorf("option requires an argument -- '%c'", arg[i])
+				}
+				i = len(arg)
+			default:
+				return nil, nil, fmt.Errorf("invalid option -- '%c'", arg[i])
+			}
+		}
+	}
+	return flags, args, nil
+}
+
+// eachInput calls fn with the content of each file, or of stdin when there are none or for "-".
+// Files that cannot be opened are reported on stderr and make the command exit with status 1.
+func eachInput(hc interp.HandlerContext, name string, files []string, fn func(file string, r io.Reader) error) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var status error
+	for _, file := range files {
+		if file == "-" {
+			stdin := hc.Stdin
+			if stdin == nil {
+				stdin = strings.NewReader("")
+			}
+			if err := fn(file, stdin); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, err := os.Open(builtinPath(hc, file))
+		if err != nil {
+			fmt.Fprintf(hc.Stderr, "%s: %s: %v\n", name, file, unwrapPathError(err))
+			status = interp.NewExitStatus(1)
+			continue
+		}
+		err = fn(file, f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return status
+}
+
+func builtinPath(hc interp.HandlerContext, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(hc.Dir, path)
+}
+
+func unwrapPathError(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+	return err
+}
+
+// readLines calls fn for each line of r, without its line terminator.
+func readLines(r io.Reader, fn func(line string) bool) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if !fn(strings.TrimSuffix(line, "\n")) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func builtinCat(hc interp.HandlerContext, args []string) error {
+	_, files, err := builtinFlags(args, "u", "")
+	if err != nil {
+		return err
+	}
+	return eachInput(hc, "cat", files, func(_ string, r io.Reader) error {
+		_, err := io.Copy(hc.Stdout, r)
+		return err
+	})
+}
+
+func builtinWc(hc interp.HandlerContext, args []string) error {
+	flags, files, err := builtinFlags(args, "lwcm", "")
+	if err != nil {
+		return err
+	}
+	if len(flags) == 0 {
+		flags = map[byte]string{'l': "", 'w': "", 'c': ""}
+	}
+
+	var totals [3]int
+	printCounts := func(counts [3]int, name string) {
+		var fields []string
+		for i, flag := range []byte{'l', 'w', 'c'} {
+			_, ok := flags[flag]
+			if flag == 'c' {
+				_, m := flags['m']
+				ok = ok || m
+			}
+			if ok {
+				fields = append(fields, strconv.Itoa(counts[i]))
+			}
+		}
+		if name != "" {
+			fields = append(fields, name)
+		}
+		fmt.Fprintln(hc.Stdout, strings.Join(fields, " "))
+	}
+
+	status := eachInput(hc, "wc", files, func(file string, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		counts := [3]int{bytes.Count(content, []byte("\n")), len(bytes.Fields(content)), len(content)}
+		if _, ok := flags['m']; ok {
+			counts[2] = len([]rune(string(content)))
+		}
+		for i := range totals {
+			totals[i] += counts[i]
+		}
+		if file == "-" && len(files) == 0 {
+			file = ""
+		}
+		printCounts(counts, file)
+		return nil
+	})
+	if len(files) > 1 {
+		printCounts(totals, "total")
+	}
+	return status
+}
+
+func builtinGrep(hc interp.HandlerContext, args []string) error {
+	flags, operands, err := builtinFlags(args, "cEFHhilnqvx", "e")
+	if err != nil {
+		return err
+	}
+	pattern, hasPattern := flags['e']
+	if !hasPattern {
+		if len(operands) == 0 {
+			return fmt.Errorf("no pattern given")
+		}
+		pattern, operands = operands[0], operands[1:]
+	}
+	_, fixed := flags['F']
+	_, extended := flags['E']
+	_, ignoreCase := flags['i']
+	_, invert := flags['v']
+	_, count := flags['c']
+	_, quiet := flags['q']
+	_, listFiles := flags['l']
+	_, lineNumbers := flags['n']
+	_, wholeLine := flags['x']
+	_, withNames := flags['H']
+	if _, ok := flags['h']; !ok && len(operands) > 1 {
+		withNames = true
+	}
+
+	if fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	} else if !extended {
+		if pattern, err = basicRegexp(pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if wholeLine {
+		pattern = "^(?:" + pattern + ")$"
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	matched := false
+	status := eachInput(hc, "grep", operands, func(file string, r io.Reader) error {
+		if file == "-" {
+			file = "(standard input)"
+		}
+		matches, lineNum := 0, 0
+		err := readLines(r, func(line string) bool {
+			lineNum++
+			if re.MatchString(line) == invert {
+				return true
+			}
+			matches++
+			matched = true
+			if quiet || count || listFiles {
+				return !quiet && !listFiles
+			}
+			prefix := ""
+			if withNames {
+				prefix = file + ":"
+			}
+			if lineNumbers {
+				prefix += strconv.Itoa(lineNum) + ":"
+			}
+			fmt.Fprintln(hc.Stdout, prefix+line)
+			return true
+		})
+		switch {
+		case quiet:
+		case listFiles && matches > 0:
+			fmt.Fprintln(hc.Stdout, file)
+		case count && withNames:
+			fmt.Fprintf(hc.Stdout, "%s:%d\n", file, matches)
+		case count:
+			fmt.Fprintln(hc.Stdout, matches)
+		}
+		return err
+	})
+	if status != nil && !(quiet && matched) {
+		return interp.NewExitStatus(2)
+	}
+	if !matched {
+		return interp.NewExitStatus(1)
+	}
+	return nil
+}
+
+// basicRegexp translates a POSIX basic regular expression, with the GNU extensions `\|`, `\+`, `\?`, `\<` and
+// `\>`, to the syntax of the regexp package. Back-references are not supported.
+func basicRegexp(pattern string) (string, error) {
+	var b strings.Builder
+	start := true // whether `*` is literal and `^` an anchor
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		atStart := start
+		start = false
+		switch c {
+		case '\\':
+			if i+1 == len(pattern) {
+				return "", errors.New("trailing backslash")
+			}
+			i++
+			switch e := pattern[i]; {
+			case e == '(' || e == '|':
+				b.WriteByte(e)
+				start = true
+			case strings.IndexByte("){}+?", e) >= 0:
+				b.WriteByte(e)
+			case e == '<' || e == '>':
+				b.WriteString(`\b`)
+			case strings.IndexByte("wWsSbB", e) >= 0:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			case e >= '1' && e <= '9':
+				return "", errors.New("back-references are not supported")
+			case e < utf8.RuneSelf:
+				b.WriteString(regexp.QuoteMeta(string(e)))
+			default:
+				b.WriteByte(e)
+			}
+		case '*':
+			if atStart {
+				b.WriteString(`\*`)
+			} else {
+				b.WriteByte(c)
+			}
+		case '^':
+			if atStart {
+				b.WriteByte(c)
+				start = true
+			} else {
+				b.WriteString(`\^`)
+			}
+		case '$':
+			rest := pattern[i+1:]
+			if rest == "" || strings.HasPrefix(rest, `\)`) || strings.HasPrefix(rest, `\|`) {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(`\$`)
+			}
+		case '+', '?', '(', ')', '|', '{', '}':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '[':
+			end := bracketEnd(pattern, i)
+			if end < 0 {
+				return "", errors.New("unterminated bracket expression")
+			}
+			// Backslashes are literal in bracket expressions.
+			b.WriteString(strings.ReplaceAll(pattern[i:end+1], `\`, `\\`))
+			i = end
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// bracketEnd returns the index of the bracket closing the bracket expression starting at i, or -1.
+func bracketEnd(pattern string, i int) int {
+	j := i + 1
+	if j < len(pattern) && pattern[j] == '^' {
+		j++
+	}
+	if j < len(pattern) && pattern[j] == ']' {
+		j++
+	}
+	for ; j < len(pattern); j++ {
+		switch {
+		case pattern[j] == ']':
+			return j
+		case pattern[j] == '[' && j+1 < len(pattern) && strings.IndexByte(":.=", pattern[j+1]) >= 0:
+			end := strings.Index(pattern[j+2:], string(pattern[j+1])+"]")
+			if end < 0 {
+				return -1
+			}
+			j += 2 + end + 1
+		}
+	}
+	return -1
+}
+
+// lineCountFlag parses the line count of head and tail, including the obsolete -N form.
+func lineCountFlag(args []string) (string, []string, error) {
+	if len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		if _, err := strconv.Atoi(args[0][1:]); err == nil {
+			return args[0][1:], args[1:], nil
+		}
+	}
+	flags, files, err := builtinFlags(args, "qv", "n")
+	if err != nil {
+		return "", nil, err
+	}
+	count, ok := flags['n']
+	if !ok {
+		count = "10"
+	}
+	return count, files, nil
+}
+
+func builtinHead(hc interp.HandlerContext, args []string) error {
+	countFlag, files, err := lineCountFlag(args)
+	if err != nil {
+		return err
+	}
+	count, err := strconv.Atoi(countFlag)
+	if err != nil || count < 0 {
+		return fmt.Errorf("invalid number of lines: %q", countFlag)
+	}
+
+	return eachInput(hc, "head", files, func(file string, r io.Reader) error {
+		if len(files) > 1 {
+			fmt.Fprintf(hc.Stdout, "==> %s <==\n", file)
+		}
+		printed := 0
+		return readLines(r, func(line string) bool {
+			if printed >= count {
+				return false
+			}
+			fmt.Fprintln(hc.Stdout, line)
+			printed++
+			return true
+		})
+	})
+}
+
+func builtinTail(hc interp.HandlerContext, args []string) error {
+	countFlag, files, err := lineCountFlag(args)
+	if err != nil {
+		return err
+	}
+	fromStart := strings.HasPrefix(countFlag, "+")
+	count, err := strconv.Atoi(strings.TrimPrefix(countFlag, "+"))
+	if err != nil || count < 0 {
+		return fmt.Errorf("invalid number of lines: %q", countFlag)
+	}
+
+	return eachInput(hc, "tail", files, func(file string, r io.Reader) error {
+		if len(files) > 1 {
+			fmt.Fprintf(hc.Stdout, "==> %s <==\n", file)
+		}
+		var lines []string
+		lineNum := 0
+		err := readLines(r, func(line string) bool {
+			lineNum++
+			switch {
+			case fromStart:
+				if lineNum >= count {
+					lines = append(lines, line)
+				}
+			case count > 0:
+				lines = append(lines, line)
+				if len(lines) > count {
+					lines = lines[1:]
+				}
+			}
+			return true
+		})
+		for _, line := range lines {
+			fmt.Fprintln(hc.Stdout, line)
+		}
+		return err
+	})
+}
+
+func builtinLs(hc interp.HandlerContext, args []string) error {
+	flags, paths, err := builtinFlags(args, "1aAd", "")
+	if err != nil {
+		return err
+	}
+	_, all := flags['a']
+	_, almostAll := flags['A']
+	_, dirsOnly := flags['d']
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var status error
+	var files, dirs []string
+	for _, path := range paths {
+		info, err := os.Stat(builtinPath(hc, path))
+		if err != nil {
+			fmt.Fprintf(hc.Stderr, "ls: cannot access '%s': %v\n", path, unwrapPathError(err))
+			status = interp.NewExitStatus(2)
+			continue
+		}
+		if info.IsDir() && !dirsOnly {
+			dirs = append(dirs, path)
+		} else {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	sort.Strings(dirs)
+
+	for _, file := range files {
+		fmt.Fprintln(hc.Stdout, file)
+	}
+	for i, dir := range dirs {
+		if len(paths) > 1 {
+			if i > 0 || len(files) > 0 {
+				fmt.Fprintln(hc.Stdout)
+			}
+			fmt.Fprintf(hc.Stdout, "%s:\n", dir)
+		}
+		entries, err := os.ReadDir(builtinPath(hc, dir))
+		if err != nil {
+			fmt.Fprintf(hc.Stderr, "ls: cannot open directory '%s': %v\n", dir, unwrapPathError(err))
+			status = interp.NewExitStatus(2)
+			continue
+		}
+		if all {
+			fmt.Fprintln(hc.Stdout, ".")
+			fmt.Fprintln(hc.Stdout, "..")
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") && !all && !almostAll {
+				continue
+			}
+			fmt.Fprintln(hc.Stdout, entry.Name())
+		}
+	}
+	return status
+}
+
+func builtinBasename(hc interp.HandlerContext, args []string) error {
+	_, operands, err := builtinFlags(args, "", "")
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 || len(operands) > 2 {
+		return fmt.Errorf("usage: basename string [suffix]")
+	}
+	base := filepath.Base(operands[0])
+	if len(operands) == 2 && base != operands[1] {
+		base = strings.TrimSuffix(base, operands[1])
+	}
+	fmt.Fprintln(hc.Stdout, base)
+	return nil
+}
+
+func builtinDirname(hc interp.HandlerContext, args []string) error {
+	_, operands, err := builtinFlags(args, "", "")
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 {
+		return fmt.Errorf("missing operand")
+	}
+	for _, operand := range operands {
+		fmt.Fprintln(hc.Stdout, filepath.Dir(operand))
+	}
+	return nil
+}
+
+func builtinWhich(hc interp.HandlerContext, args []string) error {
+	_, names, err := builtinFlags(args, "a", "")
+	if err != nil {
+		return err
+	}
+	var status error
+	for _, name := range names {
+		if path, err := interp.LookPathDir(hc.Dir, hc.Env, name); err == nil {
+			fmt.Fprintln(hc.Stdout, path)
+		} else if _, ok := portableBuiltins[name]; ok {
+			fmt.Fprintln(hc.Stdout, name)
+		} else {
+			status = interp.NewExitStatus(1)
+		}
+	}
+	return status
+}
@@ -0,0 +1,104 @@
+package expression_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestPortableBuiltins(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"a.txt":   "one\ntwo\nthree\nfour\n",
+		"b.txt":   "alpha beta\nGamma\n",
+		".hidden": "secret\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	// Without PATH, commands can only resolve to the portable builtins.
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"DIR": tempDir},
+		[]expression.Option{expression.WithEnvMode(expression.CleanEnv), expression.WithPortableBuiltins()},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"cat file", `$("cat $DIR/b.txt")`, "alpha beta\nGamma"},
+		{"cat stdin", `$("cat", {input: "from stdin"})`, "from stdin"},
+		{"wc lines", `$("wc -l < $DIR/a.txt")`, "4"},
+		{"wc all", `$("cat $DIR/b.txt | wc")`, "2 3 17"},
+		{"wc files", `$("cd $DIR && wc -l a.txt b.txt")`, "4 a.txt\n2 b.txt\n6 total"},
+		{"grep", `$("grep o $DIR/a.txt")`, "one\ntwo\nfour"},
+		{"grep flags", `$("grep -in gamma $DIR/b.txt")`, "2:Gamma"},
+		{"grep count", `$("grep -vc o $DIR/a.txt")`, "1"},
+		{"grep no match", `$("grep zeta $DIR/a.txt || echo none")`, "none"},
+		{"grep basic alternation", `$("grep -n 'ne\\|ee' $DIR/a.txt")`, "1:one\n3:three"},
+		{"grep basic group", `$("grep -c 't\\(wo\\|hree\\)' $DIR/a.txt")`, "2"},
+		{"grep basic interval", `$("grep 'o\\{2\\}'", {input: "fo\nfoo"})`, "foo"},
+		{"grep basic literal plus", `$("grep 'a+b'", {input: "a+b\nab"})`, "a+b"},
+		{"grep basic literal parentheses", `$("grep '(x)'", {input: "(x)\nx"})`, "(x)"},
+		{"grep basic literal question mark", `$("grep 'o?b'", {input: "foo?bar\nfobar"})`, "foo?bar"},
+		{"grep basic repetition", `$("grep -x 'fo\\+?bar'", {input: "foo?bar\nf?bar"})`, "foo?bar"},
+		{"grep basic leading star", `$("grep '*a'", {input: "*a\na"})`, "*a"},
+		{"grep extended", `$("grep -E 'a+b|\\(x\\)'", {input: "a+b\nab\n(x)"})`, "ab\n(x)"},
+		{"grep extended alternation", `$("grep -En 'ne|ee' $DIR/a.txt")`, "1:one\n3:three"},
+		{"head", `$("head -n 2 $DIR/a.txt")`, "one\ntwo"},
+		{"head obsolete form", `$("head -1 $DIR/a.txt")`, "one"},
+		{"tail", `$("tail -n 2 $DIR/a.txt")`, "three\nfour"},
+		{"tail from line", `$("tail -n +3 $DIR/a.txt")`, "three\nfour"},
+		{"ls", `$("ls $DIR")`, "a.txt\nb.txt"},
+		{"ls all", `$("cd $DIR && ls -A")`, ".hidden\na.txt\nb.txt"},
+		{"basename", `$("basename /path/to/file.txt .txt")`, "file"},
+		{"dirname", `$("dirname /path/to/file.txt")`, "/path/to"},
+		{"which", `$("which cat")`, "cat"},
+		{"test", `$("test -f $DIR/a.txt && cat $DIR/a.txt | wc -l")`, "4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := expression.EvaluateString(`$("cat $DIR/missing.txt")`, data)
+		if err == nil || !strings.Contains(err.Error(), "missing.txt: no such file or directory") {
+			t.Errorf("expected missing file error, got %v", err)
+		}
+	})
+
+	t.Run("back-reference", func(t *testing.T) {
+		_, err := expression.EvaluateString(`$("grep '\\(o\\)\\1' $DIR/a.txt")`, data)
+		if err == nil || !strings.Contains(err.Error(), "back-references are not supported") {
+			t.Errorf("expected back-reference error, got %v", err)
+		}
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		_, err := expression.EvaluateString(`$("head -z $DIR/a.txt")`, data)
+		if err == nil || !strings.Contains(err.Error(), "invalid option") {
+			t.Errorf("expected invalid option error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package expression
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/expr-lang/expr"
+	"go.yaml.in/yaml/v3"
+)
+
+// BuildDataFromFiles is like BuildData, but loads the variables from JSON, YAML or TOML files, as with
+// WithDataFiles.
+func BuildDataFromFiles(ctx context.Context, envMap map[string]string, files ...string) (Data, error) {
+	return BuildDataWithOptions(ctx, envMap, []Option{WithDataFiles(files...)})
+}
+
+// WithDataFiles loads variables from JSON, YAML or TOML files, depending on their extension (`.json`,
+// `.yaml`, `.yml` or `.toml`). The file `-` is read from stdin as YAML, which also accepts JSON.
+//
+// Data sources are deep-merged in order: maps are merged key by key, while other values of later sources
+// replace those of earlier ones. Variables given as key-value pairs or with WithVars are merged last, and
+// built-ins take precedence over all of them.
+func WithDataFiles(files ...string) Option {
+	return func(s *session) {
+		for _, file := range files {
+			s.dataSources = append(s.dataSources, dataSource{path: file})
+		}
+	}
+}
+
+// WithDataReader loads variables from a reader, such as os.Stdin, in the given format: "json", "yaml" or
+// "toml". It is merged like the files of WithDataFiles.
+func WithDataReader(r io.Reader, format string) Option {
+	return func(s *session) {
+		source := dataSource{path: "<" + format + " input>", reader: r, format: format}
+		s.dataSources = append(s.dataSources, source)
+	}
+}
+
+// dataSource is a file or reader holding variables.
+type dataSource struct {
+	path   string
+	reader io.Reader
+	format string
+}
+
+// loadDataSources deep-merges the variables of the data sources.
+func loadDataSources(sources []dataSource) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, source := range sources {
+		vars, err := source.load()
+		if err != nil {
+			return nil, err
+		}
+		deepMerge(merged, vars)
+	}
+	return merged, nil
+}
+
+func (d dataSource) load() (map[string]interface{}, error) {
+	format := d.format
+	var content []byte
+	var err error
+	switch {
+	case d.reader != nil:
+		content, err = io.ReadAll(d.reader)
+	case d.path == "-":
+		format = "yaml"
+		content, err = io.ReadAll(os.Stdin)
+	default:
+		format, err = dataFileFormat(d.path)
+		if err != nil {
+			return nil, err
+		}
+		content, err = os.ReadFile(filepath.Clean(d.path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading data file %s: %w", d.path, err)
+	}
+
+	value, err := decodeData(content, format)
+	if err != nil {
+		return nil, fmt.Errorf("parsing data file %s: %w", d.path, err)
+	}
+	if value == nil {
+		return make(map[string]interface{}), nil
+	}
+	vars, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parsing data file %s: expected a map, got %T", d.path, value)
+	}
+	return vars, nil
+}
+
+// decodeData decodes JSON, YAML or TOML content with normalized numbers. JSON syntax errors are reported
+// with their line and column, as YAML and TOML errors already are.
+func decodeData(content []byte, format string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err = decoder.Decode(&value); err == nil {
+			if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+				err = fmt.Errorf("unexpected data after the top-level value")
+			}
+		}
+		err = jsonErrorPosition(content, decoder.InputOffset(), err)
+	case "yaml":
+		err = yaml.Unmarshal(content, &value)
+	case "toml":
+		table := make(map[string]interface{})
+		err = toml.Unmarshal(content, &table)
+		value = table
+	default:
+		return nil, fmt.Errorf("unknown data format %q, expected json, yaml or toml", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizeNumbers(value), nil
+}
+
+// jsonErrorPosition adds the line and column of a JSON decoding error to its message.
+func jsonErrorPosition(content []byte, offset int64, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntaxErr):
+		// The offset of syntax errors follows the invalid byte.
+		offset = syntaxErr.Offset - 1
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		offset = int64(len(content))
+	}
+	line, column := offsetPosition(content, offset)
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+// offsetPosition returns the line and column of the byte at an offset in content, starting at 1.
+func offsetPosition(content []byte, offset int64) (int, int) {
+	offset = max(0, min(offset, int64(len(content))))
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// dataFileFormat returns the format of a data file from its extension.
+func dataFileFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	default:
+		return "", fmt.Errorf(
+			"unknown format of data file %s, expected a .json, .yaml, .yml or .toml extension", path)
+	}
+}
+
+// normalizeNumbers converts the numbers decoded from all formats to int when they are whole numbers, like
+// YAML decoding does, and to float64 otherwise.
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	case []map[string]interface{}:
+		for _, item := range v {
+			normalizeNumbers(item)
+		}
+	case int64:
+		return int(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// deepMerge merges src into dst: maps present in both are merged recursively, and other values of src
+// replace those of dst.
+func deepMerge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			merged := make(map[string]interface{}, len(dstMap)+len(srcMap))
+			deepMerge(merged, dstMap)
+			deepMerge(merged, srcMap)
+			dst[k] = merged
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// readerFunctions returns the functions reading structured files.
+func readerFunctions(s *session, ex string) []expr.Option {
+	var opts []expr.Option
+	for name, format := range map[string]string{"readJSON": "json", "readYAML": "yaml", "readTOML": "toml"} {
+		opts = append(opts, fileFunction(s, ex, name, func(path string) (interface{}, error) {
+			content, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeData(content, format)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+			return value, nil
+		}))
+	}
+	return append(opts, fileFunction(s, ex, "readINI", func(path string) (map[string]interface{}, error) {
+		f, err := os.Open(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		values, err := parseINI(f)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		return values, nil
+	}))
+}
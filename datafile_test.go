@@ -0,0 +1,215 @@
+package expression_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestBuildDataFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	writeFile(t, base, `
+app:
+  name: base
+  replicas: 1
+  labels:
+    team: core
+tags: [a, b]
+os: ignored
+`)
+	override := filepath.Join(dir, "override.json")
+	writeFile(t, override, `{"app": {"replicas": 3, "labels": {"tier": "web"}}, "tags": ["c"], "ratio": 0.5}`)
+	settings := filepath.Join(dir, "settings.toml")
+	writeFile(t, settings, `
+debug = true
+
+[app]
+name = "toml"
+
+[[servers]]
+host = "one"
+`)
+
+	data, err := expression.BuildDataFromFiles(context.Background(), map[string]string{"NAME": "world"},
+		base, override, settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"overridden by later file", `app.name`, "toml"},
+		{"merged from json", `app.replicas`, 3},
+		{"deep merged map", `app.labels.team + "/" + app.labels.tier`, "core/web"},
+		{"replaced list", `tags`, []interface{}{"c"}},
+		{"float", `ratio`, 0.5},
+		{"toml value", `debug`, true},
+		{"toml array of tables", `servers[0].host`, "one"},
+		{"built-in kept", `os`, runtime.GOOS},
+		{"env kept", `env.NAME`, "world"},
+		{"commands kept", `$("echo hi")`, "hi"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v (%T), got %v (%T)", test.expected, test.expected, result, result)
+			}
+		})
+	}
+}
+
+func TestNewDataWithDataSources(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	writeFile(t, file, "app:\n  name: file\n  port: 80\n")
+
+	data, err := expression.NewData(
+		context.Background(),
+		expression.WithDataFiles(file),
+		expression.WithDataReader(strings.NewReader(`app = { port = 8080 }`), "toml"),
+		expression.WithVars(map[string]interface{}{"app": map[string]interface{}{"debug": true}}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result, err := expression.Evaluate(`[app.name, app.port, app.debug]`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := []interface{}{"file", 8080, true}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestDataFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	writeFile(t, invalid, `{"app": `)
+	reserved := filepath.Join(dir, "reserved.yaml")
+	writeFile(t, reserved, "env: prod\n")
+	unknown := filepath.Join(dir, "config.ini")
+	writeFile(t, unknown, "a=b\n")
+
+	tests := []struct {
+		name     string
+		opts     []expression.Option
+		expected string
+	}{
+		{"missing file", []expression.Option{expression.WithDataFiles(filepath.Join(dir, "missing.json"))},
+			"reading data file"},
+		{"invalid file", []expression.Option{expression.WithDataFiles(invalid)}, "parsing data file " + invalid},
+		{"unknown extension", []expression.Option{expression.WithDataFiles(unknown)}, "unknown format of data file"},
+		{"unknown format", []expression.Option{expression.WithDataReader(strings.NewReader(""), "xml")},
+			`unknown data format "xml"`},
+		{"built-in collision", []expression.Option{expression.WithDataFiles(reserved)}, `variable "env" collides`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.NewData(context.Background(), test.opts...)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestReaderFunctions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "package.json"), `{"name": "web", "version": "1.2.3", "workspaces": ["a", "b"],
+"engines": {"node": 20}}`)
+	writeFile(t, filepath.Join(dir, "chart.yaml"), "name: web\ndependencies:\n  - name: redis\n    version: 17.0.0\n")
+	writeFile(t, filepath.Join(dir, "Cargo.toml"), "[package]\nname = \"web\"\nedition = 2021\n")
+	writeFile(t, filepath.Join(dir, "setup.cfg"), `; comment
+root = top
+
+[metadata]
+name = web
+version: 1.2.3 ; inline comment
+description = "quoted ; value"
+
+[options]
+python_requires = >=3.8
+`)
+	data := map[string]interface{}{"dir": dir}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"readJSON", `readJSON(dir + "/package.json").version`, "1.2.3"},
+		{"readJSON list", `readJSON(dir + "/package.json").workspaces`, []interface{}{"a", "b"}},
+		{"readJSON number", `readJSON(dir + "/package.json").engines.node`, 20},
+		{"readYAML", `readYAML(dir + "/chart.yaml").dependencies[0].version`, "17.0.0"},
+		{"readTOML", `readTOML(dir + "/Cargo.toml").package.edition`, 2021},
+		{"readINI", `readINI(dir + "/setup.cfg").metadata.name`, "web"},
+		{"readINI colon and comment", `readINI(dir + "/setup.cfg").metadata.version`, "1.2.3"},
+		{"readINI quoted", `readINI(dir + "/setup.cfg").metadata.description`, "quoted ; value"},
+		{"readINI top level", `readINI(dir + "/setup.cfg").root`, "top"},
+		{"readINI value with operator", `readINI(dir + "/setup.cfg").options.python_requires`, ">=3.8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v (%T), got %v (%T)", test.expected, test.expected, result, result)
+			}
+		})
+	}
+}
+
+func TestReaderFunctionErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"bad.json":   "{\n  \"name\": \"web\",\n  \"version\" 1\n}",
+		"short.json": "{\n  \"name\": \"web\"",
+		"bad.yaml":   "name: web\n  version: [1\n",
+		"bad.toml":   "name = \"web\"\nversion = \n",
+		"bad.ini":    "[metadata]\nname = web\njust a line\n",
+	}
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"json", `readJSON(dir + "/bad.json")`, "bad.json: line 3, column 13: invalid character '1'"},
+		{"json truncated", `readJSON(dir + "/short.json")`, "short.json: line 2, column 16: unexpected EOF"},
+		{"yaml", `readYAML(dir + "/bad.yaml")`, "bad.yaml: yaml: line 2"},
+		{"toml", `readTOML(dir + "/bad.toml")`, "bad.toml: toml: line 2"},
+		{"ini", `readINI(dir + "/bad.ini")`, "bad.ini: line 3: expected key = value"},
+		{"missing", `readJSON(dir + "/missing.json")`, "no such file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.Evaluate(test.expr, map[string]interface{}{"dir": dir})
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
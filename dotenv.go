@@ -0,0 +1,298 @@
+package expression
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithDotenvFiles loads the variables of dotenv files into `env`. Files are loaded in order, so variables of
+// later files override those of earlier ones, and variables of the env map passed to BuildDataWithOptions
+// override all of them. Values can reference other variables (`${VAR}`), except in single quotes.
+// Missing files are reported as errors.
+func WithDotenvFiles(files ...string) Option {
+	return func(s *session) {
+		for _, file := range files {
+			s.dotenvFiles = append(s.dotenvFiles, dotenvFile{path: file})
+		}
+	}
+}
+
+// WithOptionalDotenvFiles is like WithDotenvFiles, but missing files are skipped.
+func WithOptionalDotenvFiles(files ...string) Option {
+	return func(s *session) {
+		for _, file := range files {
+			s.dotenvFiles = append(s.dotenvFiles, dotenvFile{path: file, optional: true})
+		}
+	}
+}
+
+type dotenvFile struct {
+	path     string
+	optional bool
+}
+
+// loadDotenvFiles merges the variables of the dotenv files and of the env map, in order of precedence.
+// The values are returned as documents to be expanded by expandEnvironment, along with the variables whose
+// values are literal and must not be expanded.
+func loadDotenvFiles(files []dotenvFile, envMap map[string]string) (map[string]string, map[string]bool, error) {
+	merged := make(map[string]string)
+	literal := make(map[string]bool)
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Clean(file.path))
+		if err != nil {
+			if file.optional && os.IsNotExist(err) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("reading dotenv file %s: %w", file.path, err)
+		}
+		vars, err := parseDotenv(file.path, string(content))
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range vars {
+			merged[k] = v.value
+			literal[k] = v.literal
+		}
+	}
+	for k, v := range envMap {
+		merged[k] = v
+		delete(literal, k)
+	}
+	return merged, literal, nil
+}
+
+// dotenvParser parses the content of a dotenv file. Each line is a `KEY=value` assignment, optionally
+// prefixed with `export`. Values can be unquoted (inline comments start with ` #`), single-quoted
+// (literal), or double-quoted (supporting escapes such as `\n` and `\"`). Quoted values can span
+// multiple lines.
+type dotenvParser struct {
+	file string
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+// dotenvValue is the value of a dotenv variable. Literal values are single-quoted and not expanded.
+type dotenvValue struct {
+	value   string
+	literal bool
+}
+
+func parseDotenv(file, src string) (map[string]dotenvValue, error) {
+	p := &dotenvParser{file: file, src: src, line: 1, col: 1}
+	vars := make(map[string]dotenvValue)
+	for !p.eof() {
+		p.skipSpaces()
+		switch {
+		case p.eof():
+		case p.peek() == '\n':
+			p.next()
+		case p.peek() == '#':
+			p.skipLine()
+		default:
+			key, value, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			vars[key] = value
+		}
+	}
+	return vars, nil
+}
+
+func (p *dotenvParser) assignment() (string, dotenvValue, error) {
+	key := p.identifier()
+	if key == "export" && (p.peek() == ' ' || p.peek() == '\t') {
+		p.skipSpaces()
+		key = p.identifier()
+	}
+	if key == "" {
+		return "", dotenvValue{}, p.errorf("expected variable name, found %q", p.peek())
+	}
+	p.skipSpaces()
+	if p.peek() != '=' {
+		if p.eof() || p.peek() == '\n' {
+			return "", dotenvValue{}, p.errorf("expected '=' after %s", key)
+		}
+		return "", dotenvValue{}, p.errorf("expected '=' after %s, found %q", key, p.peek())
+	}
+	p.next()
+	p.skipSpaces()
+
+	var value dotenvValue
+	var err error
+	switch p.peek() {
+	case '\'':
+		value.literal = true
+		value.value, err = p.singleQuoted()
+	case '"':
+		value.value, err = p.doubleQuoted()
+	default:
+		return key, dotenvValue{value: p.unquoted()}, nil
+	}
+	if err != nil {
+		return "", dotenvValue{}, err
+	}
+
+	p.skipSpaces()
+	switch {
+	case p.eof():
+	case p.peek() == '\n':
+		p.next()
+	case p.peek() == '#':
+		p.skipLine()
+	default:
+		return "", dotenvValue{}, p.errorf("unexpected %q after quoted value of %s", p.peek(), key)
+	}
+	return key, value, nil
+}
+
+func (p *dotenvParser) identifier() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (p.pos > start && c >= '0' && c <= '9') {
+			p.next()
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+// unquoted reads a value up to the end of the line or an inline comment.
+func (p *dotenvParser) unquoted() string {
+	start := p.pos
+	end := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		if p.peek() == '#' && (p.pos == start || p.src[p.pos-1] == ' ' || p.src[p.pos-1] == '\t') {
+			p.skipLine()
+			return strings.TrimRight(p.src[start:end], " \t\r")
+		}
+		p.next()
+		end = p.pos
+	}
+	value := strings.TrimRight(p.src[start:end], " \t\r")
+	if !p.eof() {
+		p.next()
+	}
+	return value
+}
+
+func (p *dotenvParser) singleQuoted() (string, error) {
+	line, col := p.line, p.col
+	p.next()
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.eof() {
+		return "", p.errorAt(line, col, "unterminated single-quoted value")
+	}
+	value := p.src[start:p.pos]
+	p.next()
+	return value, nil
+}
+
+func (p *dotenvParser) doubleQuoted() (string, error) {
+	line, col := p.line, p.col
+	p.next()
+	// plain holds the decoded value and doc the same value as a document for expandEnvironment, where
+	// literal backslashes and dollar signs are escaped.
+	var plain, doc strings.Builder
+	expand := false
+	for {
+		if p.eof() {
+			return "", p.errorAt(line, col, "unterminated double-quoted value")
+		}
+		c := p.next()
+		switch c {
+		case '"':
+			if expand {
+				return doc.String(), nil
+			}
+			return plain.String(), nil
+		case '$':
+			expand = true
+			plain.WriteByte(c)
+			doc.WriteByte(c)
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			escLine, escCol := p.line, p.col-1
+			e := p.next()
+			var decoded string
+			switch e {
+			case 'n':
+				decoded = "\n"
+			case 't':
+				decoded = "\t"
+			case 'r':
+				decoded = "\r"
+			case '"', '\\', '$', '\'':
+				decoded = string(e)
+			case '\n':
+				decoded = ""
+			default:
+				return "", p.errorAt(escLine, escCol, "invalid escape sequence \\%c", e)
+			}
+			if e == '$' {
+				expand = true
+			}
+			plain.WriteString(decoded)
+			doc.WriteString(documentEscaper.Replace(decoded))
+		default:
+			plain.WriteByte(c)
+			doc.WriteString(documentEscaper.Replace(string(c)))
+		}
+	}
+}
+
+// documentEscaper escapes literal text in documents expanded by expandEnvironment.
+var documentEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`)
+
+func (p *dotenvParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *dotenvParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *dotenvParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+		p.col = 1
+	} else {
+		p.col++
+	}
+	return c
+}
+
+func (p *dotenvParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.next()
+	}
+}
+
+func (p *dotenvParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *dotenvParser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.line, p.col, format, args...)
+}
+
+func (p *dotenvParser) errorAt(line, col int, format string, args ...interface{}) error {
+	return fmt.Errorf("parsing dotenv file %s:%d:%d: %s", p.file, line, col, fmt.Sprintf(format, args...))
+}
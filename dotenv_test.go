@@ -0,0 +1,130 @@
+package expression_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestBuildDataDotenvFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	envFile := filepath.Join(tempDir, ".env")
+	localFile := filepath.Join(tempDir, ".env.local")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create dotenv file: %v", err)
+		}
+	}
+	writeFile(envFile, `# project settings
+APP=app
+export ROOT=/opt/${APP}
+BIN = ${ROOT}/bin  # inline comment
+HASH=value#not-a-comment
+LITERAL='${ROOT} stays \n literal'
+ESCAPED="line1\nline2 \"quoted\" \$ROOT \\ ${APP}"
+MULTILINE="first
+second"
+EMPTY=
+OVERRIDDEN=env
+`)
+	writeFile(localFile, "OVERRIDDEN=local\nLOCAL=${BIN}/local\n")
+
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"EXPLICIT": "${APP}-explicit", "APP": "myapp"},
+		[]expression.Option{
+			expression.WithDotenvFiles(envFile, localFile),
+			expression.WithOptionalDotenvFiles(filepath.Join(tempDir, "missing.env")),
+		},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"APP", "myapp"},
+		{"ROOT", "/opt/myapp"},
+		{"BIN", "/opt/myapp/bin"},
+		{"HASH", "value#not-a-comment"},
+		{"LITERAL", `${ROOT} stays \n literal`},
+		{"ESCAPED", "line1\nline2 \"quoted\" $ROOT \\ myapp"},
+		{"MULTILINE", "first\nsecond"},
+		{"EMPTY", ""},
+		{"OVERRIDDEN", "local"},
+		{"LOCAL", "/opt/myapp/bin/local"},
+		{"EXPLICIT", "myapp-explicit"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			result, err := expression.EvaluateString(`env["`+test.key+`"]`, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := expression.BuildDataWithOptions(
+			context.Background(), nil,
+			[]expression.Option{expression.WithDotenvFiles(filepath.Join(tempDir, "missing.env"))},
+		)
+		if err == nil || !strings.Contains(err.Error(), "reading dotenv file") {
+			t.Errorf("expected missing file error, got %v", err)
+		}
+	})
+
+	t.Run("backticks and command substitutions", func(t *testing.T) {
+		file := filepath.Join(tempDir, "commands.env")
+		writeFile(file, "APP=app\nSINGLE='lit`x`$y $(id)'\nDOUBLE=\"q`echo $x` $(id) $APP\"\nUNQUOTED=`x` $APP\n")
+		data, err := expression.BuildDataWithOptions(
+			context.Background(), nil, []expression.Option{expression.WithDotenvFiles(file)},
+		)
+		if err != nil {
+			t.Fatalf("expected no error building data, got %v", err)
+		}
+		for key, expected := range map[string]string{
+			"SINGLE":   "lit`x`$y $(id)",
+			"DOUBLE":   "q`echo $x` $(id) app",
+			"UNQUOTED": "`x` app",
+		} {
+			if result, err := expression.EvaluateString(`env["`+key+`"]`, data); err != nil || result != expected {
+				t.Errorf("expected %s to be %q, got %q (%v)", key, expected, result, err)
+			}
+		}
+	})
+
+	malformed := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{"missing equals", "A=1\nINVALID LINE\n", ":2:9: expected '=' after INVALID, found 'L'"},
+		{"invalid name", "A=1\n  1A=2\n", ":2:3: expected variable name, found '1'"},
+		{"unterminated quote", "A=1\nB=\"open\nC=3\n", ":2:3: unterminated double-quoted value"},
+		{"trailing text", "A='x' y\n", ":1:7: unexpected 'y' after quoted value of A"},
+		{"invalid escape", `A="\q"`, ":1:4: invalid escape sequence \\q"},
+	}
+	for _, test := range malformed {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(tempDir, "malformed.env")
+			writeFile(file, test.content)
+			_, err := expression.BuildDataWithOptions(
+				context.Background(), nil, []expression.Option{expression.WithDotenvFiles(file)},
+			)
+			if err == nil || !strings.Contains(err.Error(), file+test.errMsg) {
+				t.Errorf("expected error containing %q, got %v", file+test.errMsg, err)
+			}
+		})
+	}
+}
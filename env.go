@@ -0,0 +1,311 @@
+package expression
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// setEnvFunctions sets the functions looking up environment variables in the data.
+func (s *session) setEnvFunctions(m map[string]interface{}, ex string) {
+	s.setBuiltin(m, "getenv", func(name string, defaultValue ...string) (string, error) {
+		if len(defaultValue) > 1 {
+			return "", fmt.Errorf("getenv() takes at most 1 default value")
+		}
+		value, ok, err := s.lookupEnv("getenv", ex, name)
+		if err != nil || ok {
+			return value, err
+		}
+		if len(defaultValue) == 1 {
+			return defaultValue[0], nil
+		}
+		return "", nil
+	})
+	s.setBuiltin(m, "hasEnv", func(name string) (bool, error) {
+		_, ok, err := s.lookupEnv("hasEnv", ex, name)
+		return ok, err
+	})
+	s.setBuiltin(m, "requireEnv", func(name string) (string, error) {
+		return s.requireEnv(ex, name)
+	})
+}
+
+// requireEnv looks up an environment variable, failing when it is missing.
+func (s *session) requireEnv(ex, name string) (string, error) {
+	value, ok, err := s.lookupEnv("requireEnv", ex, name)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("missing required environment variable %s", name)
+	}
+	return value, nil
+}
+
+// lookupEnv looks up an environment variable in the env map, then in the host environment visible to
+// commands. Host variables are recorded when recording, and not looked up when replaying.
+func (s *session) lookupEnv(fn, ex, name string) (string, bool, error) {
+	var value string
+	var ok bool
+	event := AuditEvent{Kind: AuditEnv, Operation: fn, Target: name, Expression: ex}
+	err := s.audit(event, func() (int, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if value, ok = s.env[name]; ok || s.replay != nil {
+			return len(value), nil
+		}
+		if value, ok = s.lookupHostEnv(name); ok && s.recorder != nil {
+			s.recordEnv(map[string]string{name: value})
+		}
+		return len(value), nil
+	})
+	return value, ok, err
+}
+
+// checkRequiredEnv looks up the variables required by the `requireEnv` calls with a literal name that always
+// run in an expression, and reports all the missing ones at once, so that they can be fixed together. It returns
+// the values found, which the calls reuse instead of looking the variables up again. Calls that may not run, such
+// as in the branches of `? :` or on the right of `&&`, `||` and `??`, are only checked when they run.
+func (s *session) checkRequiredEnv(ex string) (map[string]string, error) {
+	name := s.nameOf("requireEnv")
+	if name == "" || !strings.Contains(ex, name) {
+		return nil, nil
+	}
+	tree, err := parser.Parse(ex)
+	if err != nil {
+		return nil, nil // reported when compiling the expression
+	}
+
+	finder := &requiredEnvFinder{name: name, conditional: make(callSet)}
+	ast.Walk(&tree.Node, finder)
+	values := make(map[string]string)
+	var missing []string
+	for _, call := range finder.calls {
+		name := call.Arguments[0].(*ast.StringNode).Value
+		if _, ok := values[name]; ok || finder.conditional[call] || slices.Contains(missing, name) {
+			continue
+		}
+		value, ok, err := s.lookupEnv("requireEnv", ex, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values[name] = value
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// requiredEnvFinder collects the `requireEnv` calls taking a string literal, where name is the name of the
+// `requireEnv` function in the data, and the calls that may not run.
+type requiredEnvFinder struct {
+	name        string
+	calls       []*ast.CallNode
+	conditional callSet
+}
+
+func (f *requiredEnvFinder) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.CallNode:
+		if ident, ok := n.Callee.(*ast.IdentifierNode); !ok || ident.Value != f.name || len(n.Arguments) != 1 {
+			return
+		}
+		if _, ok := n.Arguments[0].(*ast.StringNode); ok {
+			f.calls = append(f.calls, n)
+		}
+	case *ast.ConditionalNode:
+		ast.Walk(&n.Exp1, f.conditional)
+		ast.Walk(&n.Exp2, f.conditional)
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "&&", "||", "and", "or", "??":
+			ast.Walk(&n.Right, f.conditional)
+		}
+	case *ast.PredicateNode:
+		ast.Walk(&n.Node, f.conditional)
+	case *ast.ChainNode:
+		ast.Walk(&n.Node, f.conditional)
+	}
+}
+
+// callSet is a set of calls, collecting the calls of the trees it visits.
+type callSet map[*ast.CallNode]bool
+
+func (c callSet) Visit(node *ast.Node) {
+	if call, ok := (*node).(*ast.CallNode); ok {
+		c[call] = true
+	}
+}
+
+// expandEnvironment returns a copy of env where references to other variables are expanded, without
+// modifying env. Values are expanded like shell strings, so `$VAR`, `${VAR}` and `${VAR:-default}` are
+// supported, while command substitutions such as `$(command)` or backticks are kept as is. Variables of env
+// referencing each other are expanded in dependency order, and cycles are reported as errors. References to
+// variables missing from env, or of a variable to itself such as `PATH=/opt/bin:$PATH`, are resolved with lookup.
+// The variables in literal are kept as is.
+func expandEnvironment(
+	env map[string]string, literal map[string]bool, lookup func(name string) (string, bool),
+) (map[string]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+
+	parser := syntax.NewParser()
+	words := make(map[string]*syntax.Word)
+	deps := make(map[string][]string)
+	for key, value := range env {
+		if literal[key] || !strings.Contains(value, "$") {
+			continue
+		}
+		word, err := parser.Document(strings.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("parsing env variable %s: %w", key, err)
+		}
+		words[key] = word
+		syntax.Walk(word, func(node syntax.Node) bool {
+			switch node := node.(type) {
+			case *syntax.CmdSubst:
+				return false
+			case *syntax.ParamExp:
+				if node.Param != nil {
+					name := node.Param.Value
+					if _, ok := env[name]; ok && name != key {
+						deps[key] = append(deps[key], name)
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	order, err := envExpansionOrder(words, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := make(map[string]string, len(env))
+	for key, value := range env {
+		if _, ok := words[key]; !ok {
+			expanded[key] = value
+		}
+	}
+	for _, key := range order {
+		source := env[key]
+		cfg := &expand.Config{
+			Env: &expansionEnviron{self: key, vars: expanded, lookup: lookup},
+			CmdSubst: func(w io.Writer, cs *syntax.CmdSubst) error {
+				_, err := io.WriteString(w, source[cs.Pos().Offset():cs.End().Offset()])
+				return err
+			},
+		}
+		value, err := expand.Document(cfg, words[key])
+		if err != nil {
+			return nil, fmt.Errorf("expanding env variable %s: %w", key, err)
+		}
+		expanded[key] = value
+	}
+	return expanded, nil
+}
+
+// envExpansionOrder sorts the variables to expand so that each one comes after its dependencies.
+func envExpansionOrder(words map[string]*syntax.Word, deps map[string][]string) ([]string, error) {
+	keys := make([]string, 0, len(words))
+	for key := range words {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	order := make([]string, 0, len(keys))
+	var path []string
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch state[key] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, k := range path {
+				if k == key {
+					start = i
+				}
+			}
+			cycle := append(append([]string(nil), path[start:]...), key)
+			return fmt.Errorf("env variables reference each other in a cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[key] = visiting
+		path = append(path, key)
+		for _, dep := range deps[key] {
+			if _, ok := words[dep]; !ok {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = visited
+		order = append(order, key)
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := visit(key); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// expansionEnviron resolves the variables referenced by the value of self.
+type expansionEnviron struct {
+	self   string
+	vars   map[string]string
+	lookup func(name string) (string, bool)
+}
+
+func (e *expansionEnviron) Get(name string) expand.Variable {
+	value, ok := e.vars[name]
+	if !ok || name == e.self {
+		if e.lookup == nil {
+			return expand.Variable{}
+		}
+		if value, ok = e.lookup(name); !ok {
+			return expand.Variable{}
+		}
+	}
+	return expand.Variable{Set: true, Exported: true, Kind: expand.String, Str: value}
+}
+
+func (e *expansionEnviron) Each(fn func(name string, vr expand.Variable) bool) {
+	for name := range e.vars {
+		if !fn(name, e.Get(name)) {
+			return
+		}
+	}
+}
+
+func environmentToSlice(env map[string]string) []string {
+	envSlice := make([]string, 0, len(env))
+	for key, value := range env {
+		envSlice = append(envSlice, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(envSlice)
+	return envSlice
+}
@@ -0,0 +1,236 @@
+package expression_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestBuildDataEnvExpansion(t *testing.T) {
+	t.Setenv("EXPR_TEST_HOST", "host")
+	envMap := map[string]string{
+		"ROOT":    "/opt",
+		"BIN":     "${ROOT}/bin",
+		"TOOL":    "$BIN/tool",
+		"DEFAULT": "${EXPR_TEST_MISSING:-fallback}",
+		"HOST":    "$EXPR_TEST_HOST-value",
+		"SELF":    "extra:${EXPR_TEST_SELF:-none}",
+		"PLAIN":   "no references",
+		"PROMPT":  "$(whoami)@`hostname` ${ROOT}",
+		"NESTED":  "${EXPR_TEST_MISSING:-$BIN/lib}",
+		"OTHER":   "${ROOT:+set} ${#ROOT}",
+		"ESCAPED": "\\$ROOT costs $",
+	}
+	original := make(map[string]string, len(envMap))
+	for k, v := range envMap {
+		original[k] = v
+	}
+
+	data, err := expression.BuildData(context.Background(), envMap)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"reference", `env.BIN`, "/opt/bin"},
+		{"transitive reference", `env.TOOL`, "/opt/bin/tool"},
+		{"default value", `env.DEFAULT`, "fallback"},
+		{"host reference", `env.HOST`, "host-value"},
+		{"self reference", `env.SELF`, "extra:none"},
+		{"plain value", `env.PLAIN`, "no references"},
+		{"command substitution", `env.PROMPT`, "$(whoami)@`hostname` /opt"},
+		{"nested default", `env.NESTED`, "/opt/bin/lib"},
+		{"parameter expansions", `env.OTHER`, "set 4"},
+		{"escaped reference", `env.ESCAPED`, "$ROOT costs $"},
+		{"command environment", `$("echo $TOOL")`, "/opt/bin/tool"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	for k, v := range original {
+		if envMap[k] != v {
+			t.Errorf("expected env map to be unchanged, %s changed from %q to %q", k, v, envMap[k])
+		}
+	}
+
+	t.Run("self reference resolves to host", func(t *testing.T) {
+		t.Setenv("EXPR_TEST_PATH", "/usr/bin")
+		data, err := expression.BuildData(
+			context.Background(), map[string]string{"EXPR_TEST_PATH": "/opt/bin:$EXPR_TEST_PATH"},
+		)
+		if err != nil {
+			t.Fatalf("expected no error building data, got %v", err)
+		}
+		result, err := expression.EvaluateString(`env.EXPR_TEST_PATH`, data)
+		if err != nil || result != "/opt/bin:/usr/bin" {
+			t.Errorf("expected %q, got %q (%v)", "/opt/bin:/usr/bin", result, err)
+		}
+	})
+
+	t.Run("clean env mode ignores host", func(t *testing.T) {
+		data, err := expression.BuildDataWithOptions(
+			context.Background(),
+			map[string]string{"HOST": "${EXPR_TEST_HOST:-unset}"},
+			[]expression.Option{expression.WithEnvMode(expression.CleanEnv)},
+		)
+		if err != nil {
+			t.Fatalf("expected no error building data, got %v", err)
+		}
+		result, err := expression.EvaluateString(`env.HOST`, data)
+		if err != nil || result != "unset" {
+			t.Errorf("expected %q, got %q (%v)", "unset", result, err)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		_, err := expression.BuildData(context.Background(), map[string]string{
+			"A": "${B}", "B": "${C}/x", "C": "$A", "D": "$A",
+		})
+		if err == nil || !strings.Contains(err.Error(), "cycle: A -> B -> C -> A") {
+			t.Errorf("expected cycle error, got %v", err)
+		}
+	})
+}
+
+func TestEnvFunctions(t *testing.T) {
+	t.Setenv("EXPR_TEST_HOST", "host")
+	data, err := expression.BuildData(context.Background(), map[string]string{"NAME": "world", "EMPTY": ""})
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"getenv", `getenv("NAME")`, "world"},
+		{"getenv default", `getenv("EXPR_TEST_MISSING", "fallback")`, "fallback"},
+		{"getenv empty value", `getenv("EMPTY", "fallback")`, ""},
+		{"getenv host fallback", `getenv("EXPR_TEST_HOST", "fallback")`, "host"},
+		{"getenv missing", `getenv("EXPR_TEST_MISSING")`, ""},
+		{"hasEnv", `hasEnv("EMPTY")`, "true"},
+		{"hasEnv host", `hasEnv("EXPR_TEST_HOST")`, "true"},
+		{"hasEnv missing", `hasEnv("EXPR_TEST_MISSING")`, "false"},
+		{"requireEnv", `requireEnv("NAME") + "-" + requireEnv("EXPR_TEST_HOST")`, "world-host"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRequireEnvMissing(t *testing.T) {
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"NAME": "world"},
+		[]expression.Option{expression.WithEnvMode(expression.CleanEnv)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	_, err = expression.Evaluate(`requireEnv("TOKEN") + requireEnv("NAME") + requireEnv("REGION") + requireEnv("TOKEN")`, data)
+	if err == nil {
+		t.Fatal("expected an error for missing variables")
+	}
+	expected := "missing required environment variables: TOKEN, REGION"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+
+	_, err = expression.Evaluate(`requireEnv("REG" + "ION")`, data)
+	if err == nil || !strings.Contains(err.Error(), "missing required environment variable REGION") {
+		t.Errorf("expected missing variable error, got %v", err)
+	}
+
+	t.Run("conditional calls", func(t *testing.T) {
+		tests := []struct {
+			expr     string
+			expected string
+		}{
+			{`hasEnv("REGION") ? requireEnv("REGION") : "fallback"`, "fallback"},
+			{`false && requireEnv("REGION") != ""`, "false"},
+			{`true || requireEnv("REGION") != ""`, "true"},
+			{`nil ?? requireEnv("NAME")`, "world"},
+			{`filter([], {requireEnv("REGION") != ""}) == []`, "true"},
+		}
+		for _, test := range tests {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error evaluating %s, got %v", test.expr, err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %s to be %q, got %q", test.expr, test.expected, result)
+			}
+		}
+
+		_, err := expression.Evaluate(`true && requireEnv("REGION") != ""`, data)
+		if err == nil || !strings.Contains(err.Error(), "missing required environment variable REGION") {
+			t.Errorf("expected missing variable error, got %v", err)
+		}
+	})
+
+	t.Run("template", func(t *testing.T) {
+		tmpl := expression.NewTemplate("test", data)
+		if err := tmpl.Parse(`{{ requireEnv("TOKEN") + requireEnv("REGION") }}`); err != nil {
+			t.Fatalf("expected no error parsing, got %v", err)
+		}
+		_, err := tmpl.ExecuteToString()
+		if err == nil || !strings.Contains(err.Error(), "missing required environment variables: TOKEN, REGION") {
+			t.Errorf("expected missing variables error, got %v", err)
+		}
+	})
+}
+
+func TestRequireEnvAudit(t *testing.T) {
+	hook := &testAuditHook{}
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"NAME": "world"},
+		[]expression.Option{expression.WithEnvMode(expression.CleanEnv), expression.WithAuditHook(hook)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	result, err := expression.EvaluateString(`requireEnv("NAME") + requireEnv("NAME")`, data)
+	if err != nil || result != "worldworld" {
+		t.Fatalf("expected %q, got %q (%v)", "worldworld", result, err)
+	}
+	if len(hook.events) != 1 || hook.events[0].Operation != "requireEnv" || hook.events[0].Target != "NAME" {
+		t.Errorf("expected a single requireEnv event, got %+v", hook.events)
+	}
+
+	hook.events = nil
+	if _, err := expression.Evaluate(`requireEnv("TOKEN")`, data); err == nil {
+		t.Fatal("expected an error for a missing variable")
+	}
+	if len(hook.events) != 1 || hook.events[0].Target != "TOKEN" {
+		t.Errorf("expected a single requireEnv event, got %+v", hook.events)
+	}
+}
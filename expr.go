@@ -2,21 +2,24 @@ package expression
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/vm"
-	"mvdan.cc/sh/v3/expand"
-	"mvdan.cc/sh/v3/interp"
-	"mvdan.cc/sh/v3/syntax"
 )
 
 func IsTruthy(ex string, data Data) (bool, error) {
@@ -30,41 +33,72 @@ func IsTruthy(ex string, data Data) (bool, error) {
 		return v, nil
 	case int, int64, float64, uint, uint64:
 		return v != 0, nil
+	case Secret:
+		return isTruthyString(v.Reveal())
 	case string:
-		truthy, err := strconv.ParseBool(strings.Trim(v, `"' `))
-		if err != nil {
-			return false, err
-		}
-		return truthy, nil
+		return isTruthyString(v)
 	default:
 		return false, nil
 	}
 }
 
+func isTruthyString(v string) (bool, error) {
+	truthy, err := strconv.ParseBool(strings.Trim(v, `"' `))
+	if err != nil {
+		return false, err
+	}
+	return truthy, nil
+}
+
 func Evaluate(ex string, data Data) (interface{}, error) {
+	output, ev, err := evaluate(ex, data)
+	if err != nil {
+		return nil, err
+	}
+	return ev.wrapSecret(output), nil
+}
+
+// evaluate evaluates an expression, returning its output with the secrets of the data unwrapped, and the
+// evaluation redacting them. Errors are already redacted.
+func evaluate(ex string, data Data) (interface{}, *evaluation, error) {
 	var program *vm.Program
 	var err error
-	opts := additionalFunctions()
+	s := sessionFromData(data)
+	ev := s.newEvaluation()
+	opts := additionalFunctions(s, ex)
+	if s != nil {
+		var sessionOpts []expr.Option
+		data, sessionOpts, err = s.forExpression(data.(map[string]interface{}), ex, ev)
+		if err != nil {
+			return nil, ev, ev.redactError(err)
+		}
+		opts = append(opts, sessionOpts...)
+	}
 	if data != nil && !reflect.ValueOf(data).IsNil() {
 		opts = append(opts, expr.Env(data))
 	}
 	program, err = expr.Compile(ex, opts...)
 	if err != nil {
-		return nil, err
+		return nil, ev, ev.redactError(err)
 	}
 
 	output, err := expr.Run(program, data)
 	if err != nil {
-		return nil, err
+		return nil, ev, ev.redactError(err)
 	}
-	return output, nil
+	return output, ev, nil
 }
 
 func EvaluateString(ex string, data Data) (string, error) {
-	output, err := Evaluate(ex, data)
+	output, ev, err := evaluate(ex, data)
 	if err != nil {
 		return "", err
 	}
+	result, err := formatOutput(ex, output)
+	return ev.redact(result), err
+}
+
+func formatOutput(ex string, output interface{}) (string, error) {
 	switch o := output.(type) {
 	case string:
 		return o, nil
@@ -74,6 +108,8 @@ func EvaluateString(ex string, data Data) (string, error) {
 		return strconv.FormatBool(o), nil
 	case []byte:
 		return string(o), nil
+	case Secret:
+		return o.String(), nil
 	default:
 		if output == nil {
 			return "", nil
@@ -92,211 +128,255 @@ func EvaluateString(ex string, data Data) (string, error) {
 
 type Data interface{}
 
+// sessionKey is the Data key holding the session of the built-in functions. It is not a valid identifier, and
+// `$env` is replaced with the data without it, but it is still listed when ranging over the Data.
+const sessionKey = "\x00session"
+
+// dataFunction is the function replacing `$env` in expressions evaluated with a session.
+const dataFunction = "$data"
+
+// dataOptions returns the options replacing `$env` with a copy of data without the session. When auditing,
+// reading the env map through it is reported to the audit hook.
+func (s *session) dataOptions(data map[string]interface{}, ex string) []expr.Option {
+	return []expr.Option{
+		expr.Function(dataFunction, func(...interface{}) (interface{}, error) {
+			visible := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				if k != sessionKey {
+					visible[k] = v
+				}
+			}
+			if name := s.nameOf("env"); s.auditHook != nil && name != "" {
+				env, err := s.auditedEnv(ex)
+				if err != nil {
+					return nil, err
+				}
+				visible[name] = env
+			}
+			return visible, nil
+		}, new(func() map[string]interface{})),
+		expr.Patch(dataPatcher{}),
+	}
+}
+
+// dataPatcher replaces `$env` with calls to the data function.
+type dataPatcher struct{}
+
+func (dataPatcher) Visit(node *ast.Node) {
+	if ident, ok := (*node).(*ast.IdentifierNode); ok && ident.Value == "$env" {
+		ast.Patch(node, &ast.CallNode{Callee: &ast.IdentifierNode{Value: dataFunction}})
+	}
+}
+
+// Option configures optional behavior of the data built by BuildDataWithOptions.
+type Option func(*session)
+
+// session holds the configuration and state shared by the built-in functions of a Data object.
+type session struct {
+	ctx              context.Context
+	env              map[string]string
+	inheritStdin     bool
+	envMode          EnvMode
+	envAllowlist     []string
+	portableBuiltins bool
+	maxParallel      int
+	outputHandler    OutputHandler
+	stdoutWriter     io.Writer
+	stderrWriter     io.Writer
+	commandID        atomic.Int64
+	recorder         *Recorder
+	replay           *replayer
+	auditHook        AuditHook
+	dotenvFiles      []dotenvFile
+	vars             map[string]interface{}
+	builtinNames     map[string]string
+	noShell          bool
+	optionErrs       []error
+	namespaces       map[string]*namespace
+	dataSources      []dataSource
+	schema           Schema
+	secretEnv        []string
+	secretReveal     bool
+	// secrets are the values of the secrets, longest first, and secretVars the variables holding secrets
+	// with their values unwrapped.
+	secrets    []string
+	secretVars map[string]interface{}
+
+	// mu guards the lookups of environment variables.
+	mu sync.Mutex
+}
+
+// sessionFromData returns the session of data built by BuildData, or nil for any other data.
+func sessionFromData(data Data) *session {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	s, _ := m[sessionKey].(*session)
+	return s
+}
+
+// WithInheritedStdin connects the standard input of the current process to commands run through `$`
+// when no explicit input is given. By default, commands read from an empty stdin so that they can
+// neither consume the caller's piped input nor block waiting on a terminal.
+func WithInheritedStdin() Option {
+	return func(s *session) {
+		s.inheritStdin = true
+	}
+}
+
 // BuildData constructs a Data object from a context, environment map, and key-value pairs.
 // It provides the following variables by default:
 // - `os`: string for the  operating system (e.g., "linux", "darwin")
 // - `arch`: string for the architecture (e.g., "amd64", "arm64")
-// - `env`: the environment variables passed in the envMap
+// - `env`: the environment variables passed in the envMap, with references to other variables expanded
 // - `$`: a function that takes a shell command as input and returns its output as a string
+// - `run`: a function that takes a program name and a list of arguments, quotes them and returns the output
+// - `parallel`: a function that runs a list of shell commands concurrently and returns their outputs in order
+// - `$json`, `$yaml`, `$lines` and `$fields`: functions like `$` that parse the stdout of the command as JSON,
+// YAML, a list of lines or a list of whitespace-separated fields
+// - `getenv`, `hasEnv` and `requireEnv`: functions looking up environment variables in `env`, then in the host
+// environment
+//
+// Keys can be paths building nested maps and lists: `app.name` sets the `name` key of the `app` map,
+// `servers[0]` the first item of the `servers` list, and `labels["app.kubernetes.io/name"]` a key containing
+// dots. Paths going through a value that is neither a map nor a list are reported as conflicts.
 func BuildData(ctx context.Context, envMap map[string]string, kvPairs ...interface{}) (Data, error) {
-	kvMap := make(map[string]interface{})
+	return BuildDataWithOptions(ctx, envMap, nil, kvPairs...)
+}
+
+// BuildDataWithOptions is like BuildData but applies the given options to the built-in functions.
+//
+// The `$` and `run` functions accept an optional map as their last argument with the following keys:
+// - `input`: a string (or bytes) passed to the command as its standard input
+func BuildDataWithOptions(
+	ctx context.Context, envMap map[string]string, opts []Option, kvPairs ...interface{},
+) (Data, error) {
 	if len(kvPairs)%2 != 0 {
 		return nil, fmt.Errorf("uneven number of key-value pairs")
 	}
 
+	s := newSession(ctx, opts)
+	maps.Copy(s.env, envMap)
 	for i := 0; i < len(kvPairs); i += 2 {
 		key, ok := kvPairs[i].(string)
 		if !ok {
 			return nil, fmt.Errorf("key must be a string, got %T", kvPairs[i])
 		}
-		value := kvPairs[i+1]
-		kvMap[key] = value
+		if err := setKeyPath(s.vars, key, kvPairs[i+1]); err != nil {
+			return nil, err
+		}
 	}
+	return s.build(false)
+}
 
-	kvMap["os"] = runtime.GOOS
-	kvMap["arch"] = runtime.GOARCH
-	kvMap["env"] = envMap
-	kvMap["$"] = func(command string) (string, error) {
-		output, err := execute(ctx, command, environmentToSlice(envMap))
+// loadEnvironment sets the environment of the session from the env map, the dotenv files or the replayed
+// bundle.
+func (s *session) loadEnvironment() error {
+	if s.replay != nil {
+		s.env = s.replay.bundle.Env
+	} else {
+		envMap := s.env
+		var literal map[string]bool
+		if len(s.dotenvFiles) > 0 {
+			merged, literalVars, err := loadDotenvFiles(s.dotenvFiles, envMap)
+			if err != nil {
+				return err
+			}
+			envMap, literal = merged, literalVars
+		}
+		expanded, err := expandEnvironment(envMap, literal, s.lookupHostEnv)
 		if err != nil {
-			return "", fmt.Errorf("command failed: %v, output: %s", err, output)
+			return err
 		}
-		return strings.TrimSpace(output), nil
+		s.env = expanded
 	}
-
-	return kvMap, nil
+	return nil
 }
 
-func execute(ctx context.Context, cmd string, envList []string) (string, error) {
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	parser := syntax.NewParser()
-	reader := strings.NewReader(strings.TrimSpace(cmd))
-	prog, err := parser.Parse(reader, "")
-	if err != nil {
-		return "", fmt.Errorf("unable to parse command - %w", err)
-	}
-
-	if envList == nil {
-		envList = make([]string, 0)
-	}
-	envList = append(os.Environ(), envList...)
-
-	stdOutBuffer := &strings.Builder{}
-	stdErrBuffer := &strings.Builder{}
-
-	runner, err := interp.New(
-		interp.Env(expand.ListEnviron(envList...)),
-		interp.StdIO(
-			os.Stdin,
-			stdOutBuffer,
-			stdErrBuffer,
-		),
-	)
-	if err != nil {
-		return "", fmt.Errorf("unable to create runner - %w", err)
+// setFunctions sets the functions of the data, bound to the expression they are called from.
+func (s *session) setFunctions(m map[string]interface{}, ex string) {
+	s.setBuiltin(m, "os", runtime.GOOS)
+	s.setBuiltin(m, "arch", runtime.GOARCH)
+	s.setBuiltin(m, "env", s.env)
+	for builtin, ns := range s.namespaces {
+		s.setBuiltin(m, builtin, ns)
 	}
-
-	err = runner.Run(ctx, prog)
-	if err != nil {
-		var exitStatus interp.ExitStatus
-		if errors.As(err, &exitStatus) {
-			return stdErrBuffer.String(), fmt.Errorf("command exited with non-zero status %w", exitStatus)
-		}
-		return stdErrBuffer.String(), fmt.Errorf("encountered an error executing command - %w", err)
-	}
-	output := stdOutBuffer.String()
-	if stderr := stdErrBuffer.String(); stderr != "" {
-		output += "\n" + stderr
-	}
-	return strings.TrimSpace(output), nil
+	s.setCommandFunctions(m, ex, nil)
+	s.setEnvFunctions(m, ex)
 }
 
-func environmentToSlice(env map[string]string) []string {
-	for k, v := range env {
-		if strings.Contains(v, "$") || strings.Contains(v, "{") {
-			env[k] = os.ExpandEnv(v)
+// setCommandFunctions sets the functions running commands in the data. Commands found in the prefetched
+// results, if any, are served from them instead of being executed.
+func (s *session) setCommandFunctions(m map[string]interface{}, ex string, prefetched prefetchedResults) {
+	s.setBuiltin(m, "$", func(command string, cmdOpts ...map[string]interface{}) (string, error) {
+		return s.runCommand("$", ex, command, cmdOpts, prefetched)
+	})
+	s.setBuiltin(m, "run", func(name string, params ...interface{}) (string, error) {
+		command, cmdOpts, err := argvCommand(name, params)
+		if err != nil {
+			return "", err
 		}
+		return s.runCommand("run", ex, command, cmdOpts, prefetched)
+	})
+	s.setBuiltin(m, "parallel", func(commands []interface{}) ([]string, error) {
+		return s.runParallel(ex, commands, prefetched)
+	})
+	for name, parse := range outputParsers {
+		s.setBuiltin(m, name, func(command string, cmdOpts ...map[string]interface{}) (interface{}, error) {
+			return s.runParsedCommand(name, ex, command, cmdOpts, prefetched, parse)
+		})
 	}
-
-	var envSlice []string
-	for key, value := range env {
-		envSlice = append(envSlice, fmt.Sprintf("%s=%s", key, value))
-	}
-	return envSlice
 }
 
-func additionalFunctions() []expr.Option {
-	return []expr.Option{
+func additionalFunctions(s *session, ex string) []expr.Option {
+	opts := []expr.Option{
 		// File existence and type checking
-		expr.Function("fileExists", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return false, fmt.Errorf("fileExists() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return false, fmt.Errorf("fileExists() requires string argument")
-			}
-			_, err := os.Stat(path)
-			return err == nil, nil
+		statFunction(s, ex, "fileExists", func(fs.FileInfo) bool {
+			return true
 		}),
 
-		expr.Function("dirExists", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return false, fmt.Errorf("dirExists() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return false, fmt.Errorf("dirExists() requires string argument")
-			}
+		fileFunction(s, ex, "dirExists", func(path string) (bool, error) {
 			info, err := os.Stat(path)
 			return err == nil && info.IsDir(), nil
 		}),
-		expr.Function("isFile", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return false, fmt.Errorf("isFile() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return false, fmt.Errorf("isFile() requires string argument")
-			}
-			info, err := os.Stat(path)
-			return err == nil && !info.IsDir(), nil
+		statFunction(s, ex, "isFile", func(info fs.FileInfo) bool {
+			return !info.IsDir() && info.Mode()&fs.ModeSymlink == 0
 		}),
-		expr.Function("isDir", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return false, fmt.Errorf("isDir() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return false, fmt.Errorf("isDir() requires string argument")
-			}
+		fileFunction(s, ex, "isDir", func(path string) (bool, error) {
 			info, err := os.Stat(path)
 			return err == nil && info.IsDir(), nil
 		}),
 
+		// Shell helpers
+		pathFunction("shellQuote", shellQuote),
+
 		// Path operations
-		expr.Function("basename", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return "", fmt.Errorf("basename() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return "", fmt.Errorf("basename() requires string argument")
-			}
+		pathFunction("basename", func(path string) (string, error) {
 			return filepath.Base(path), nil
 		}),
-		expr.Function("dirname", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return "", fmt.Errorf("dirname() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return "", fmt.Errorf("dirname() requires string argument")
-			}
+		pathFunction("dirname", func(path string) (string, error) {
 			return filepath.Dir(path), nil
 		}),
 
 		// File content operations
-		expr.Function("readFile", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return "", fmt.Errorf("readFile() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return "", fmt.Errorf("readFile() requires string argument")
-			}
+		fileFunction(s, ex, "readFile", func(path string) (string, error) {
 			content, err := os.ReadFile(path)
 			if err != nil {
 				return "", err
 			}
 			return string(content), nil
 		}),
-		expr.Function("fileSize", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return int64(0), fmt.Errorf("fileSize() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return int64(0), fmt.Errorf("fileSize() requires string argument")
-			}
+		fileFunction(s, ex, "fileSize", func(path string) (int64, error) {
 			info, err := os.Stat(path)
 			if err != nil {
-				return int64(0), err
+				return 0, err
 			}
 			return info.Size(), nil
 		}),
 
 		// File time operations
-		expr.Function("fileModTime", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return time.Time{}, fmt.Errorf("fileModTime() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return time.Time{}, fmt.Errorf("fileModTime() requires string argument")
-			}
+		fileFunction(s, ex, "fileModTime", func(path string) (time.Time, error) {
 			info, err := os.Stat(path)
 			if err != nil {
 				return time.Time{}, err
@@ -304,19 +384,82 @@ func additionalFunctions() []expr.Option {
 			return info.ModTime(), nil
 		}),
 
-		expr.Function("fileAge", func(params ...interface{}) (interface{}, error) {
-			if len(params) != 1 {
-				return time.Duration(0), fmt.Errorf("fileAge() takes exactly 1 argument")
-			}
-			path, ok := params[0].(string)
-			if !ok {
-				return time.Duration(0), fmt.Errorf("fileAge() requires string argument")
-			}
+		fileFunction(s, ex, "fileAge", func(path string) (time.Duration, error) {
 			info, err := os.Stat(path)
 			if err != nil {
-				return time.Duration(0), err
+				return 0, err
 			}
 			return time.Since(info.ModTime()), nil
 		}),
 	}
+	opts = append(opts, fsFunctions(s, ex)...)
+	opts = append(opts, hashFunctions(s, ex)...)
+	opts = append(opts, readerFunctions(s, ex)...)
+	opts = append(opts, pathOperations()...)
+	opts = append(opts, permissionFunctions(s, ex)...)
+	return append(opts, searchFunctions(s, ex)...)
+}
+
+// pathFunction defines an expression function that takes exactly 1 string argument.
+func pathFunction[T any](name string, fn func(path string) (T, error)) expr.Option {
+	return expr.Function(name, func(params ...interface{}) (interface{}, error) {
+		var zero T
+		if len(params) != 1 {
+			return zero, fmt.Errorf("%s() takes exactly 1 argument", name)
+		}
+		path, ok := params[0].(string)
+		if !ok {
+			return zero, fmt.Errorf("%s() requires string argument", name)
+		}
+		return fn(path)
+	})
+}
+
+// fileFunction defines a path function that accesses the file system. When the expression data has
+// a session, its calls are audited, and recorded or served from the replay bundle.
+func fileFunction[T any](s *session, ex, name string, fn func(path string) (T, error)) expr.Option {
+	if s == nil {
+		return pathFunction(name, fn)
+	}
+	return pathFunction(name, func(path string) (T, error) {
+		return fileCall(s, ex, name, path, nil, func() (T, error) {
+			return fn(path)
+		})
+	})
+}
+
+// fileCall performs a call of a function accessing the file system. When the expression data has a session,
+// the call is audited, and recorded or served from the replay bundle. Calls with options are recorded
+// under the path followed by the options.
+func fileCall[T any](
+	s *session, ex, name, path string, opts options, fn func() (T, error),
+) (T, error) {
+	if s == nil {
+		return fn()
+	}
+	key := path
+	if len(opts) > 0 {
+		encoded, err := json.Marshal(opts)
+		if err != nil {
+			var zero T
+			return zero, fmt.Errorf("%s() options: %w", name, err)
+		}
+		key += " " + string(encoded)
+	}
+
+	var result T
+	event := AuditEvent{Kind: AuditFile, Operation: name, Target: path, Expression: ex}
+	err := s.audit(event, func() (int, error) {
+		var err error
+		if s.replay != nil {
+			result, err = replayFile[T](s.replay, name, s.redact(key))
+		} else {
+			result, err = fn()
+			if s.recorder != nil {
+				s.recordFile(name, key, result, err)
+			}
+		}
+		return resultSize(result), err
+	})
+	return result, err
 }
@@ -1,10 +1,13 @@
 package expression_test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -161,6 +164,283 @@ func TestBuildDataExec(t *testing.T) {
 	}
 }
 
+func TestBuildDataExecStdin(t *testing.T) {
+	ctx := context.Background()
+	data, err := expression.BuildData(ctx, map[string]string{}, "payload", "hello from input")
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"empty stdin by default", `$("cat")`, ""},
+		{"string input", `$("cat", {input: "hello"})`, "hello"},
+		{"input from data", `$("tr a-z A-Z", {input: payload})`, "HELLO FROM INPUT"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("unknown option", func(t *testing.T) {
+		_, err := expression.EvaluateString(`$("cat", {stdin: "hello"})`, data)
+		if err == nil || !strings.Contains(err.Error(), `unknown option "stdin"`) {
+			t.Errorf("expected unknown option error, got %v", err)
+		}
+	})
+}
+
+func TestBuildDataWithInheritedStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	if _, err := w.WriteString("piped input"); err != nil {
+		t.Fatalf("failed to write to pipe: %v", err)
+	}
+	w.Close()
+
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+
+	data, err := expression.BuildDataWithOptions(
+		context.Background(), map[string]string{}, []expression.Option{expression.WithInheritedStdin()},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	result, err := expression.EvaluateString(`$("cat", {input: nil})`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "" {
+		t.Errorf("expected an explicit nil input to be empty, got %q", result)
+	}
+
+	result, err = expression.EvaluateString(`$("cat")`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "piped input" {
+		t.Errorf("expected %q, got %q", "piped input", result)
+	}
+}
+
+func TestBuildDataRun(t *testing.T) {
+	ctx := context.Background()
+	data, err := expression.BuildData(ctx, map[string]string{}, "dir", "a b; echo hijacked", "n", 3)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"no arguments", `run("pwd") != ""`, "true"},
+		{"literal arguments", `run("echo", ["hello", "world"])`, "hello world"},
+		{"unsafe argument", `run("echo", [dir])`, "a b; echo hijacked"},
+		{"numeric argument", `run("echo", ["-n", n])`, "3"},
+		{"arguments with input", `run("tr", ["a-z", "A-Z"], {input: "abc"})`, "ABC"},
+		{"shellQuote in command", `$("echo " + shellQuote(dir))`, "a b; echo hijacked"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("non-list arguments", func(t *testing.T) {
+		_, err := expression.EvaluateString(`run("echo", "hello")`, data)
+		if err == nil || !strings.Contains(err.Error(), "arguments must be a list") {
+			t.Errorf("expected list error, got %v", err)
+		}
+	})
+}
+
+func TestBuildDataEnvMode(t *testing.T) {
+	t.Setenv("EXPR_TEST_HOST", "host")
+	t.Setenv("EXPR_TEST_ALLOWED", "allowed")
+	t.Setenv("EXPR_TEST_DUP", "host")
+	envMap := map[string]string{"EXPR_TEST_DUP": "provided", "PATH": os.Getenv("PATH")}
+	command := `$("echo ${EXPR_TEST_HOST:-unset} ${EXPR_TEST_ALLOWED:-unset} ${EXPR_TEST_DUP:-unset}")`
+
+	tests := []struct {
+		name     string
+		opts     []expression.Option
+		expected string
+	}{
+		{"inherit by default", nil, "host allowed provided"},
+		{"inherit all", []expression.Option{expression.WithEnvMode(expression.InheritEnv)}, "host allowed provided"},
+		{
+			"inherit allowlist",
+			[]expression.Option{expression.WithEnvMode(expression.InheritAllowedEnv, "EXPR_TEST_ALLOW*", "EXPR_TEST_DUP")},
+			"unset allowed provided",
+		},
+		{"clean", []expression.Option{expression.WithEnvMode(expression.CleanEnv)}, "unset unset provided"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := expression.BuildDataWithOptions(context.Background(), envMap, test.opts)
+			if err != nil {
+				t.Fatalf("expected no error building data, got %v", err)
+			}
+			result, err := expression.EvaluateString(command, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestBuildDataParallel(t *testing.T) {
+	for _, limit := range []int{0, 1, 4} {
+		data, err := expression.BuildDataWithOptions(
+			context.Background(), map[string]string{}, []expression.Option{expression.WithMaxParallel(limit)},
+		)
+		if err != nil {
+			t.Fatalf("expected no error building data, got %v", err)
+		}
+
+		result, err := expression.EvaluateString(
+			`join(parallel(["sleep 0.02; echo first", "echo second", "echo third"]), ",")`, data,
+		)
+		if err != nil {
+			t.Fatalf("expected no error with limit %d, got %v", limit, err)
+		}
+		if result != "first,second,third" {
+			t.Errorf("expected outputs in order with limit %d, got %q", limit, result)
+		}
+	}
+
+	t.Run("failed command", func(t *testing.T) {
+		data, err := expression.BuildData(context.Background(), map[string]string{})
+		if err != nil {
+			t.Fatalf("expected no error building data, got %v", err)
+		}
+		_, err = expression.Evaluate(`parallel(["echo ok", "echo boom >&2; exit 1"])`, data)
+		if err == nil || !strings.Contains(err.Error(), `command "echo boom >&2; exit 1" failed`) ||
+			!strings.Contains(err.Error(), "boom") {
+			t.Errorf("expected failed command error, got %v", err)
+		}
+	})
+}
+
+func TestBuildDataOutputStreaming(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	handler := func(cmd expression.CommandInfo, stream expression.OutputStream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, fmt.Sprintf("%d %s %s: %s", cmd.ID, cmd.Command, stream, line))
+	}
+	var stdout, stderr bytes.Buffer
+
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{},
+		[]expression.Option{
+			expression.WithOutputHandler(handler),
+			expression.WithOutputWriters(&stdout, &stderr),
+		},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	result, err := expression.EvaluateString(`$("echo one; echo two; printf warn >&2")`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "one\ntwo\n\nwarn" {
+		t.Errorf("expected full output to be returned, got %q", result)
+	}
+	if _, err := expression.EvaluateString(`$("echo three")`, data); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cmd := "echo one; echo two; printf warn >&2"
+	expected := []string{
+		"1 " + cmd + " stdout: one",
+		"1 " + cmd + " stdout: two",
+		"1 " + cmd + " stderr: warn",
+		"2 echo three stdout: three",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected lines %q, got %q", expected, lines)
+	}
+	if stdout.String() != "one\ntwo\nthree\n" || stderr.String() != "warn" {
+		t.Errorf("expected output to be copied to writers, got %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestBuildDataOutputParsing(t *testing.T) {
+	data, err := expression.BuildData(context.Background(), map[string]string{})
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"json", `$json("echo '{\"name\": \"app\", \"replicas\": 3}'").name`, "app"},
+		{"json number", `$json("echo '{\"replicas\": 3}'").replicas + 1`, 4.0},
+		{"json ignores stderr", `$json("echo warning >&2; echo '[1, 2]'")[1]`, 2.0},
+		{"yaml", `$yaml("printf 'name: app\ntags:\n  - a\n  - b\n'").tags[1]`, "b"},
+		{"lines", `$lines("printf 'a\nb\nc\n'")`, []string{"a", "b", "c"}},
+		{"lines empty", `len($lines("true"))`, 0},
+		{"lines with input", `$lines("cat", {input: "x\ny"})[1]`, "y"},
+		{"fields", `$fields("echo ' a  b\tc '")`, []string{"a", "b", "c"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if fmt.Sprintf("%#v", result) != fmt.Sprintf("%#v", test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("parse error", func(t *testing.T) {
+		_, err := expression.Evaluate(`$json("echo not json")`, data)
+		if err == nil || !strings.Contains(err.Error(), `$json() unable to parse output of "echo not json"`) ||
+			!strings.Contains(err.Error(), `output: "not json\n"`) {
+			t.Errorf("expected parse error with command and output, got %v", err)
+		}
+	})
+}
+
 func TestFileExistenceFunctions(t *testing.T) {
 	tempDir := t.TempDir()
 	testFile := filepath.Join(tempDir, "test.txt")
@@ -356,11 +636,11 @@ func TestFileOperationErrors(t *testing.T) {
 		expectError bool
 		errorMsg    string
 	}{
-		{"fileExists wrong args", `fileExists()`, true, "takes exactly 1 argument"},
+		{"fileExists wrong args", `fileExists()`, true, "takes 1 or 2 arguments"},
 		{"fileExists wrong type", `fileExists(123)`, true, "requires string argument"},
 		{"dirExists wrong args", `dirExists("a", "b")`, true, "takes exactly 1 argument"},
 		{"dirExists wrong type", `dirExists(true)`, true, "requires string argument"},
-		{"isFile wrong args", `isFile()`, true, "takes exactly 1 argument"},
+		{"isFile wrong args", `isFile()`, true, "takes 1 or 2 arguments"},
 		{"isFile wrong type", `isFile(123)`, true, "requires string argument"},
 		{"isDir wrong args", `isDir("a", "b")`, true, "takes exactly 1 argument"},
 		{"isDir wrong type", `isDir(false)`, true, "requires string argument"},
@@ -0,0 +1,368 @@
+package expression
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+)
+
+// FileInfo describes a file returned by the `glob`, `listDir` and `walk` functions with the `info` option.
+type FileInfo struct {
+	Path string `expr:"path" json:"path"`
+	Name string `expr:"name" json:"name"`
+	Size int64  `expr:"size" json:"size"`
+	// Mode holds the permission bits in octal, such as "0644".
+	Mode    string    `expr:"mode" json:"mode"`
+	ModTime time.Time `expr:"modTime" json:"modTime"`
+	IsDir   bool      `expr:"isDir" json:"isDir"`
+}
+
+func newFileInfo(path string, info fs.FileInfo) FileInfo {
+	return FileInfo{
+		Path:    path,
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    formatFileMode(info.Mode()),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+func formatFileMode(mode fs.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// options are the options passed as a map to a function.
+type options = map[string]interface{}
+
+// fileEntry is a file found by a file system function.
+type fileEntry struct {
+	path string
+	info fs.FileInfo
+}
+
+// fsFunctions returns the functions listing files.
+func fsFunctions(s *session, ex string) []expr.Option {
+	return []expr.Option{
+		fileListFunction(s, ex, "glob", []string{"info"}, func(pattern string, _ options) ([]fileEntry, error) {
+			return glob(pattern)
+		}),
+		fileListFunction(s, ex, "listDir", []string{"info", "hidden"}, func(dir string, opts options) ([]fileEntry, error) {
+			hidden, err := boolOption("listDir", opts, "hidden")
+			if err != nil {
+				return nil, err
+			}
+			return listDir(dir, hidden)
+		}),
+		fileListFunction(s, ex, "walk", []string{"info", "hidden", "ext", "maxDepth"}, func(root string, opts options) (
+			[]fileEntry, error,
+		) {
+			walkOpts, err := parseWalkOptions(opts)
+			if err != nil {
+				return nil, err
+			}
+			return walk(root, walkOpts)
+		}),
+	}
+}
+
+// fileListFunction defines a function listing files, which takes a path and an optional map of options, and
+// returns the paths of the files, or their FileInfo with the `info` option.
+func fileListFunction(
+	s *session, ex, name string, known []string, list func(path string, opts options) ([]fileEntry, error),
+) expr.Option {
+	return expr.Function(name, func(params ...interface{}) (interface{}, error) {
+		p, opts, err := pathAndOptions(name, params, known)
+		if err != nil {
+			return nil, err
+		}
+		info, err := boolOption(name, opts, "info")
+		if err != nil {
+			return nil, err
+		}
+		if info {
+			return fileCall(s, ex, name, p, opts, func() ([]FileInfo, error) {
+				entries, err := list(p, opts)
+				infos := make([]FileInfo, len(entries))
+				for i, entry := range entries {
+					infos[i] = newFileInfo(entry.path, entry.info)
+				}
+				return infos, err
+			})
+		}
+		return fileCall(s, ex, name, p, opts, func() ([]string, error) {
+			entries, err := list(p, opts)
+			paths := make([]string, len(entries))
+			for i, entry := range entries {
+				paths[i] = entry.path
+			}
+			return paths, err
+		})
+	})
+}
+
+// pathAndOptions returns the path and the optional map of options passed to a function, checking that the
+// options are known.
+func pathAndOptions(name string, params []interface{}, known []string) (string, options, error) {
+	if len(params) != 1 && len(params) != 2 {
+		return "", nil, fmt.Errorf("%s() takes 1 or 2 arguments", name)
+	}
+	p, ok := params[0].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("%s() requires string argument", name)
+	}
+	if len(params) == 1 {
+		return p, nil, nil
+	}
+	opts, ok := params[1].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("%s() requires a map of options as second argument, got %T", name, params[1])
+	}
+	for key := range opts {
+		if !slices.Contains(known, key) {
+			return "", nil, fmt.Errorf("%s() has no option %q", name, key)
+		}
+	}
+	return p, opts, nil
+}
+
+func boolOption(name string, opts options, key string) (bool, error) {
+	value, ok := opts[key]
+	if !ok {
+		return false, nil
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s() option %q must be a bool, got %T", name, key, value)
+	}
+	return b, nil
+}
+
+// glob returns the files matching a pattern. Besides the patterns of path.Match, `**` matches any number of
+// directories. As in shells, wildcards do not match names starting with a dot unless the pattern segment
+// does. Like filepath.Glob, I/O errors are ignored.
+func glob(pattern string) ([]fileEntry, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	// Walk from the longest prefix without wildcards.
+	base := 0
+	for base < len(segments)-1 && !hasGlobMeta(segments[base]) {
+		base++
+	}
+	root := filepath.FromSlash(strings.Join(segments[:base], "/"))
+	if base == 0 {
+		root = "."
+	} else if root == "" {
+		root = string(filepath.Separator)
+	}
+	patterns := segments[base:]
+
+	var entries []fileEntry
+	_ = walkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, relErr := filepath.Rel(root, p)
+		if relErr != nil || rel == "." {
+			return nil
+		}
+		names := strings.Split(filepath.ToSlash(rel), "/")
+		if globMatch(patterns, names, false, false) {
+			if info, err := d.Info(); err == nil {
+				entries = append(entries, fileEntry{path: p, info: info})
+			}
+		}
+		if d.IsDir() && !globMatch(patterns, names, true, false) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return entries, nil
+}
+
+// walkDir is filepath.WalkDir, except that a root linking to a directory is walked like the directory, as
+// filepath.Glob and shells do. Links below the root are not followed.
+func walkDir(root string, fn fs.WalkDirFunc) error {
+	if info, err := os.Lstat(root); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return filepath.WalkDir(root, fn)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return filepath.WalkDir(root, fn)
+	}
+	// A trailing separator makes WalkDir resolve the link, and the paths below it are joined to the root.
+	dir := root + string(filepath.Separator)
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if p == dir {
+			p = root
+		}
+		return fn(p, d, err)
+	})
+}
+
+func hasGlobMeta(segment string) bool {
+	return strings.ContainsAny(segment, `*?[\`)
+}
+
+// globMatch reports whether the names of a path match the pattern segments. With prefix, it reports whether
+// the names could be the directories leading to a match. Unless dotfiles is set, wildcards do not match
+// names starting with a dot.
+func globMatch(patterns, names []string, prefix, dotfiles bool) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if i > 0 && !dotfiles && isHidden(names[i-1]) {
+					return false
+				}
+				if globMatch(patterns[1:], names[i:], prefix, dotfiles) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return prefix
+		}
+		if !dotfiles && isHidden(names[0]) && !strings.HasPrefix(patterns[0], ".") {
+			return false
+		}
+		if ok, _ := path.Match(patterns[0], names[0]); !ok {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// listDir returns the entries of a directory, sorted by name.
+func listDir(dir string, hidden bool) ([]fileEntry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fileEntry, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		if !hidden && isHidden(d.Name()) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntry{path: filepath.Join(dir, d.Name()), info: info})
+	}
+	return entries, nil
+}
+
+// walkOptions filter the files returned by walk.
+type walkOptions struct {
+	exts     []string
+	maxDepth int
+	hidden   bool
+}
+
+func parseWalkOptions(opts options) (walkOptions, error) {
+	var o walkOptions
+	var err error
+	if o.hidden, err = boolOption("walk", opts, "hidden"); err != nil {
+		return o, err
+	}
+	switch ext := opts["ext"].(type) {
+	case nil:
+	case string:
+		o.exts = []string{ext}
+	case []interface{}:
+		for _, item := range ext {
+			str, ok := item.(string)
+			if !ok {
+				return o, fmt.Errorf("walk() option \"ext\" must be a string or a list of strings, got %T item", item)
+			}
+			o.exts = append(o.exts, str)
+		}
+	default:
+		return o, fmt.Errorf("walk() option \"ext\" must be a string or a list of strings, got %T", ext)
+	}
+	for i, ext := range o.exts {
+		if !strings.HasPrefix(ext, ".") {
+			o.exts[i] = "." + ext
+		}
+	}
+	if maxDepth, ok := opts["maxDepth"]; ok {
+		v := reflect.ValueOf(maxDepth)
+		if !v.CanInt() || v.Int() < 0 {
+			return o, fmt.Errorf("walk() option \"maxDepth\" must be a non-negative int, got %v", maxDepth)
+		}
+		o.maxDepth = int(v.Int())
+	}
+	return o, nil
+}
+
+// walk returns the files below a directory, excluding directories, in lexical order. A maxDepth of 1 only
+// returns the files of the directory itself, and 0 does not limit the depth. Hidden files and directories are
+// skipped unless hidden is set.
+func walk(root string, o walkOptions) ([]fileEntry, error) {
+	var entries []fileEntry
+	err := walkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		depth := strings.Count(filepath.ToSlash(rel), "/") + 1
+		if !o.hidden && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if o.maxDepth > 0 && depth >= o.maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(o.exts) > 0 && !hasExt(d.Name(), o.exts) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, fileEntry{path: p, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func hasExt(name string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
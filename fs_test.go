@@ -0,0 +1,182 @@
+package expression_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jahvon/expression"
+)
+
+// newFileTree creates files relative to a temporary directory and returns it.
+func newFileTree(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, file := range files {
+		writeFile(t, filepath.Join(root, file), file)
+	}
+	return root
+}
+
+func TestFileListFunctions(t *testing.T) {
+	root := newFileTree(t,
+		"db/a.sql", "db/sub/b.sql", "db/sub/c.txt", "db/.hidden/d.sql", ".env", "schema.sql", "readme.md",
+	)
+	old := time.Now().Add(-time.Hour)
+	for _, file := range []string{"db/a.sql", "db/sub/b.sql"} {
+		if err := os.Chtimes(filepath.Join(root, file), old, old); err != nil {
+			t.Fatalf("failed to set the time of %s: %v", file, err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(root, "readme.md"), 0644); err != nil {
+		t.Fatalf("failed to set the mode of readme.md: %v", err)
+	}
+	paths := func(files ...string) []string {
+		result := make([]string, len(files))
+		for i, file := range files {
+			result[i] = filepath.Join(root, file)
+		}
+		return result
+	}
+	data := map[string]interface{}{"root": root}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"glob", `glob(root + "/*.sql")`, paths("schema.sql")},
+		{"glob recursive", `glob(root + "/db/**/*.sql")`, paths("db/a.sql", "db/sub/b.sql")},
+		{"glob any directory", `glob(root + "/**/c.txt")`, paths("db/sub/c.txt")},
+		{"glob hidden", `glob(root + "/db/.hidden/*")`, paths("db/.hidden/d.sql")},
+		{"glob no match", `glob(root + "/*.go")`, []string{}},
+		{"listDir", `listDir(root)`, paths("db", "readme.md", "schema.sql")},
+		{"listDir hidden", `listDir(root, {hidden: true})`, paths(".env", "db", "readme.md", "schema.sql")},
+		{"walk", `walk(root + "/db")`, paths("db/a.sql", "db/sub/b.sql", "db/sub/c.txt")},
+		{"walk ext", `walk(root, {ext: "sql"})`, paths("db/a.sql", "db/sub/b.sql", "schema.sql")},
+		{"walk ext list", `walk(root, {ext: [".txt", ".md"]})`, paths("db/sub/c.txt", "readme.md")},
+		{"walk maxDepth", `walk(root, {maxDepth: 2, ext: "sql"})`, paths("db/a.sql", "schema.sql")},
+		{"walk hidden", `walk(root + "/db", {hidden: true, ext: "sql"})`,
+			paths("db/.hidden/d.sql", "db/a.sql", "db/sub/b.sql")},
+		{"info", `map(listDir(root, {info: true}), [.name, .isDir])`, []interface{}{
+			[]interface{}{"db", true}, []interface{}{"readme.md", false}, []interface{}{"schema.sql", false},
+		}},
+		{"info size", `listDir(root, {info: true})[1].size`, int64(len("readme.md"))},
+		{"info mode", `listDir(root, {info: true})[1].mode`, "0644"},
+		{"info path", `glob(root + "/*.md", {info: true})[0].path`, filepath.Join(root, "readme.md")},
+		{"newer files", `any(glob(root + "/db/**/*.sql", {info: true}), .modTime > fileModTime(root + "/schema.sql"))`,
+			false},
+		{"older files", `map(filter(walk(root, {ext: "sql", info: true}), .modTime < fileModTime(root + "/schema.sql")),` +
+			` .name)`, []interface{}{"a.sql", "b.sql"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestFileListSymlinkedRoot(t *testing.T) {
+	root := newFileTree(t, "db/a.sql", "db/sub/b.sql", "db/sub/c.txt")
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(filepath.Join(root, "db"), link); err != nil {
+		t.Skipf("cannot create symbolic links: %v", err)
+	}
+	paths := func(files ...string) []string {
+		result := make([]string, len(files))
+		for i, file := range files {
+			result[i] = filepath.Join(link, file)
+		}
+		return result
+	}
+	data := map[string]interface{}{"link": link}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"glob", `glob(link + "/*.sql")`, paths("a.sql")},
+		{"glob recursive", `glob(link + "/**/*.sql")`, paths("a.sql", "sub/b.sql")},
+		{"walk", `walk(link)`, paths("a.sql", "sub/b.sql", "sub/c.txt")},
+		{"walk maxDepth", `walk(link, {maxDepth: 1})`, paths("a.sql")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestFileListFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"unknown option", `walk(".", {depth: 1})`, `walk() has no option "depth"`},
+		{"invalid option", `walk(".", {maxDepth: "1"})`, `option "maxDepth" must be a non-negative int`},
+		{"invalid bool option", `listDir(".", {hidden: 1})`, `listDir() option "hidden" must be a bool`},
+		{"invalid pattern", `glob("[")`, `invalid pattern "["`},
+		{"missing directory", `listDir("/non/existing/dir")`, "no such file"},
+		{"too many arguments", `glob("*", {}, 1)`, "glob() takes 1 or 2 arguments"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.Evaluate(test.expr, nil)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestFileListRecordAndReplay(t *testing.T) {
+	root := newFileTree(t, "a.sql", "sub/b.sql")
+	recorder := expression.NewRecorder()
+	data, err := expression.BuildDataWithOptions(context.Background(), nil,
+		[]expression.Option{expression.WithRecorder(recorder)}, "root", root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	ex := `map(walk(root, {ext: "sql", info: true}), .name)`
+	recorded, err := expression.Evaluate(ex, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatalf("failed to remove files: %v", err)
+	}
+	replayData, err := expression.BuildDataWithOptions(context.Background(), nil,
+		[]expression.Option{expression.WithReplay(recorder.Bundle())}, "root", root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	replayed, err := expression.Evaluate(ex, replayData)
+	if err != nil {
+		t.Fatalf("expected no error replaying, got %v", err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) || len(recorded.([]interface{})) != 2 {
+		t.Errorf("expected %v, got %v", recorded, replayed)
+	}
+}
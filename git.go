@@ -0,0 +1,997 @@
+package expression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WithGitNamespace sets the `git` namespace describing the repository containing dir, or the working
+// directory when dir is empty. Its fields are read from the `.git` directory when first accessed, without
+// running git:
+// - `branch`: the current branch, empty when HEAD is detached
+// - `sha` and `shortSha`: the commit checked out, empty before the first commit
+// - `tag`: the first tag pointing at the commit checked out, empty if there is none, and `tags` all of them
+// - `dirty`: whether tracked files differ from the commit checked out, in the index or the working tree
+// - `changedFiles`: the tracked files that differ from the commit checked out, relative to the root
+// - `remoteUrl`: the URL of the `origin` remote, or of the first remote if there is no `origin`
+// - `root`: the root directory of the working tree
+//
+// Untracked files are not taken into account by `dirty` and `changedFiles`.
+func WithGitNamespace(dir string) Option {
+	return func(s *session) {
+		repo := &gitRepository{dir: dir}
+		if s.namespaces == nil {
+			s.namespaces = make(map[string]*namespace)
+		}
+		s.namespaces["git"] = newNamespace(dir, map[string]func() (interface{}, error){
+			"branch":       func() (interface{}, error) { return repo.branch() },
+			"sha":          func() (interface{}, error) { return repo.head() },
+			"shortSha":     func() (interface{}, error) { return repo.shortHead() },
+			"tag":          func() (interface{}, error) { return repo.tag() },
+			"tags":         func() (interface{}, error) { return repo.tags() },
+			"dirty":        func() (interface{}, error) { return repo.dirty() },
+			"changedFiles": func() (interface{}, error) { return repo.changedFiles() },
+			"remoteUrl":    func() (interface{}, error) { return repo.remoteURL() },
+			"root":         func() (interface{}, error) { return repo.workTree() },
+		})
+	}
+}
+
+// gitRepository reads the state of a git repository from its `.git` directory. It is opened on first use.
+type gitRepository struct {
+	dir string
+
+	once      sync.Once
+	err       error
+	root      string
+	gitDir    string
+	commonDir string
+	config    gitConfig
+	hashLen   int
+}
+
+func (r *gitRepository) open() error {
+	r.once.Do(func() {
+		r.err = r.discover()
+	})
+	return r.err
+}
+
+// discover finds the `.git` directory of the repository containing the directory of the repository, which
+// is either a directory or a file pointing to it for worktrees and submodules.
+func (r *gitRepository) discover() error {
+	dir := r.dir
+	if dir == "" {
+		dir = "."
+	}
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for dir = start; ; dir = filepath.Dir(dir) {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Stat(dotGit)
+		if err == nil && info.IsDir() {
+			r.gitDir = dotGit
+			break
+		}
+		if err == nil {
+			content, err := os.ReadFile(filepath.Clean(dotGit))
+			if err != nil {
+				return err
+			}
+			target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+			if !ok {
+				return fmt.Errorf("invalid .git file %s", dotGit)
+			}
+			target = strings.TrimSpace(target)
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(dir, target)
+			}
+			r.gitDir = filepath.Clean(target)
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			return fmt.Errorf("not a git repository: %s", start)
+		}
+	}
+	r.root = dir
+
+	r.commonDir = r.gitDir
+	if content, err := os.ReadFile(filepath.Join(r.gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(content))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(r.gitDir, common)
+		}
+		r.commonDir = filepath.Clean(common)
+	}
+
+	config, err := readGitConfig(filepath.Join(r.commonDir, "config"))
+	if err != nil {
+		return err
+	}
+	r.config = config
+	r.hashLen = sha1.Size
+	if strings.EqualFold(config.get("extensions", "", "objectformat"), "sha256") {
+		r.hashLen = sha256.Size
+	}
+	return nil
+}
+
+func (r *gitRepository) workTree() (string, error) {
+	if err := r.open(); err != nil {
+		return "", err
+	}
+	return r.root, nil
+}
+
+func (r *gitRepository) branch() (string, error) {
+	if err := r.open(); err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	ref, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref:")
+	if !ok {
+		return "", nil
+	}
+	return strings.TrimPrefix(strings.TrimSpace(ref), "refs/heads/"), nil
+}
+
+// head returns the commit checked out, or an empty string before the first commit.
+func (r *gitRepository) head() (string, error) {
+	if err := r.open(); err != nil {
+		return "", err
+	}
+	sha, err := r.resolveRef("HEAD")
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return sha, err
+}
+
+func (r *gitRepository) shortHead() (string, error) {
+	sha, err := r.head()
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return sha, err
+}
+
+// resolveRef returns the object name of a ref, following symbolic refs.
+func (r *gitRepository) resolveRef(ref string) (string, error) {
+	for range 10 {
+		value, err := r.readRef(ref)
+		if err != nil {
+			return "", err
+		}
+		target, ok := strings.CutPrefix(value, "ref:")
+		if !ok {
+			return value, nil
+		}
+		ref = strings.TrimSpace(target)
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs resolving %s", ref)
+}
+
+// readRef returns the content of a loose ref, or the object name of a packed ref.
+func (r *gitRepository) readRef(ref string) (string, error) {
+	for _, dir := range []string{r.gitDir, r.commonDir} {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if err == nil {
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+	packed, err := r.packedRefs()
+	if err != nil {
+		return "", err
+	}
+	if p, ok := packed[ref]; ok {
+		return p.sha, nil
+	}
+	return "", fmt.Errorf("ref %s: %w", ref, fs.ErrNotExist)
+}
+
+type packedRef struct {
+	sha    string
+	peeled string
+}
+
+// packedRefs reads the packed-refs file, along with the commits tags are peeled to, if known.
+func (r *gitRepository) packedRefs() (map[string]packedRef, error) {
+	refs := make(map[string]packedRef)
+	content, err := os.ReadFile(filepath.Join(r.commonDir, "packed-refs"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return refs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	last := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "^"):
+			if p, ok := refs[last]; ok {
+				p.peeled = line[1:]
+				refs[last] = p
+			}
+		default:
+			sha, name, ok := strings.Cut(line, " ")
+			if ok {
+				refs[name] = packedRef{sha: sha}
+				last = name
+			}
+		}
+	}
+	return refs, nil
+}
+
+func (r *gitRepository) tag() (string, error) {
+	tags, err := r.tags()
+	if err != nil || len(tags) == 0 {
+		return "", err
+	}
+	return tags[0], nil
+}
+
+// tags returns the sorted names of the tags pointing at the commit checked out.
+func (r *gitRepository) tags() ([]string, error) {
+	head, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0)
+	if head == "" {
+		return tags, nil
+	}
+
+	refs, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	tagsDir := filepath.Join(r.commonDir, "refs", "tags")
+	err = filepath.WalkDir(tagsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(r.commonDir, path)
+		refs[filepath.ToSlash(rel)] = packedRef{sha: strings.TrimSpace(string(content))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for ref, p := range refs {
+		name, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok {
+			continue
+		}
+		target := p.peeled
+		if target == "" {
+			if target, err = r.peel(p.sha); err != nil {
+				return nil, fmt.Errorf("reading tag %s: %w", name, err)
+			}
+		}
+		if target == head {
+			tags = append(tags, name)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// peel returns the object annotated tags point to.
+func (r *gitRepository) peel(sha string) (string, error) {
+	if sha == "" {
+		return "", nil
+	}
+	for range 10 {
+		kind, data, err := r.readObject(sha)
+		if err != nil {
+			return "", err
+		}
+		if kind != "tag" {
+			return sha, nil
+		}
+		object, ok := objectHeader(data, "object")
+		if !ok {
+			return "", fmt.Errorf("invalid tag object %s", sha)
+		}
+		sha = object
+	}
+	return "", fmt.Errorf("too many levels of tags peeling %s", sha)
+}
+
+func (r *gitRepository) remoteURL() (string, error) {
+	if err := r.open(); err != nil {
+		return "", err
+	}
+	if url := r.config.get("remote", "origin", "url"); url != "" {
+		return url, nil
+	}
+	for _, entry := range r.config {
+		if entry.section == "remote" && entry.key == "url" {
+			return entry.value, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *gitRepository) dirty() (bool, error) {
+	changed, err := r.changedFiles()
+	return len(changed) > 0, err
+}
+
+// changedFiles returns the sorted paths of the tracked files that differ from the commit checked out,
+// either in the index or in the working tree.
+func (r *gitRepository) changedFiles() ([]string, error) {
+	head, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	headFiles := make(map[string]gitTreeEntry)
+	if head != "" {
+		kind, data, err := r.readObject(head)
+		if err != nil {
+			return nil, err
+		}
+		tree, ok := objectHeader(data, "tree")
+		if kind != "commit" || !ok {
+			return nil, fmt.Errorf("invalid commit object %s", head)
+		}
+		if err := r.readTree(tree, "", headFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	index, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for path, entry := range index.entries {
+		if entry.stage != 0 {
+			changed[path] = true
+			continue
+		}
+		if h, ok := headFiles[path]; !ok || h.sha != entry.sha || h.mode != entry.mode {
+			changed[path] = true
+			continue
+		}
+		modified, err := r.modifiedInWorkTree(path, entry, index.modTime)
+		if err != nil {
+			return nil, err
+		}
+		if modified {
+			changed[path] = true
+		}
+	}
+	for path := range headFiles {
+		if _, ok := index.entries[path]; !ok {
+			changed[path] = true
+		}
+	}
+
+	files := make([]string, 0, len(changed))
+	for path := range changed {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+const (
+	gitModeSymlink = 0o120000
+	gitModeGitlink = 0o160000
+)
+
+// modifiedInWorkTree reports whether a file of the working tree differs from its index entry. Files whose
+// size and modification time match the index are assumed unchanged, unless they were modified after the
+// index was written.
+func (r *gitRepository) modifiedInWorkTree(path string, entry gitIndexEntry, indexModTime int64) (bool, error) {
+	if entry.skipWorkTree || entry.mode == gitModeGitlink {
+		return false, nil
+	}
+	file := filepath.Join(r.root, filepath.FromSlash(path))
+	info, err := os.Lstat(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	isSymlink := info.Mode()&fs.ModeSymlink != 0
+	if isSymlink != (entry.mode == gitModeSymlink) || (!isSymlink && !info.Mode().IsRegular()) {
+		return true, nil
+	}
+	if !isSymlink && r.config.get("core", "", "filemode") != "false" &&
+		(info.Mode()&0o111 != 0) != (entry.mode&0o111 != 0) {
+		return true, nil
+	}
+
+	modTime := info.ModTime()
+	// The index stores sizes truncated to 32 bits.
+	if uint32(info.Size()) == entry.size &&
+		modTime.Unix() == entry.modSec && int64(modTime.Nanosecond()) == entry.modNsec &&
+		modTime.UnixNano() < indexModTime {
+		return false, nil
+	}
+
+	var content io.Reader
+	var size int64
+	if isSymlink {
+		target, err := os.Readlink(file)
+		if err != nil {
+			return false, err
+		}
+		content, size = strings.NewReader(target), int64(len(target))
+	} else {
+		f, err := os.Open(filepath.Clean(file))
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		content, size = f, info.Size()
+	}
+	sha, err := r.hashObject("blob", size, content)
+	if err != nil {
+		return false, err
+	}
+	return sha != entry.sha, nil
+}
+
+// hashObject computes the object name of content as a git object.
+func (r *gitRepository) hashObject(kind string, size int64, content io.Reader) (string, error) {
+	var h hash.Hash
+	if r.hashLen == sha256.Size {
+		h = sha256.New()
+	} else {
+		h = sha1.New()
+	}
+	fmt.Fprintf(h, "%s %d\x00", kind, size)
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type gitTreeEntry struct {
+	mode uint32
+	sha  string
+}
+
+// readTree adds the files of a tree and its subtrees to files.
+func (r *gitRepository) readTree(sha, prefix string, files map[string]gitTreeEntry) error {
+	kind, data, err := r.readObject(sha)
+	if err != nil {
+		return err
+	}
+	if kind != "tree" {
+		return fmt.Errorf("invalid tree object %s", sha)
+	}
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || len(data) < nul+1+r.hashLen {
+			return fmt.Errorf("invalid tree object %s", sha)
+		}
+		var mode uint32
+		if _, err := fmt.Sscanf(string(data[:space]), "%o", &mode); err != nil {
+			return fmt.Errorf("invalid tree object %s: %w", sha, err)
+		}
+		path := prefix + string(data[space+1:nul])
+		entrySha := hex.EncodeToString(data[nul+1 : nul+1+r.hashLen])
+		data = data[nul+1+r.hashLen:]
+
+		if mode == 0o40000 {
+			if err := r.readTree(entrySha, path+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[path] = gitTreeEntry{mode: mode, sha: entrySha}
+	}
+	return nil
+}
+
+type gitIndex struct {
+	entries map[string]gitIndexEntry
+	// modTime is the modification time of the index file, in nanoseconds.
+	modTime int64
+}
+
+type gitIndexEntry struct {
+	mode         uint32
+	sha          string
+	size         uint32
+	modSec       int64
+	modNsec      int64
+	stage        int
+	skipWorkTree bool
+}
+
+// readIndex reads the entries of the index file, in version 2, 3 or 4.
+func (r *gitRepository) readIndex() (*gitIndex, error) {
+	file := filepath.Join(r.gitDir, "index")
+	index := &gitIndex{entries: make(map[string]gitIndexEntry)}
+	info, err := os.Stat(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index.modTime = info.ModTime().UnixNano()
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := fmt.Errorf("invalid index file %s", file)
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, invalid
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d in %s", version, file)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	pos := 12
+	previous := ""
+	for range count {
+		start := pos
+		if len(data) < pos+40+r.hashLen+2 {
+			return nil, invalid
+		}
+		stat := func(i int) uint32 { return binary.BigEndian.Uint32(data[pos+4*i:]) }
+		entry := gitIndexEntry{
+			modSec:  int64(stat(2)),
+			modNsec: int64(stat(3)),
+			mode:    stat(6),
+			size:    stat(9),
+		}
+		pos += 40
+		entry.sha = hex.EncodeToString(data[pos : pos+r.hashLen])
+		pos += r.hashLen
+		flags := binary.BigEndian.Uint16(data[pos:])
+		pos += 2
+		entry.stage = int(flags>>12) & 3
+		if flags&0x4000 != 0 && version >= 3 {
+			if len(data) < pos+2 {
+				return nil, invalid
+			}
+			entry.skipWorkTree = binary.BigEndian.Uint16(data[pos:])&0x4000 != 0
+			pos += 2
+		}
+
+		var path string
+		if version == 4 {
+			strip, n := gitOffsetVarint(data[pos:])
+			if n == 0 || strip > len(previous) {
+				return nil, invalid
+			}
+			pos += n
+			nul := bytes.IndexByte(data[pos:], 0)
+			if nul < 0 {
+				return nil, invalid
+			}
+			path = previous[:len(previous)-strip] + string(data[pos:pos+nul])
+			pos += nul + 1
+		} else {
+			nul := bytes.IndexByte(data[pos:], 0)
+			if nul < 0 {
+				return nil, invalid
+			}
+			path = string(data[pos : pos+nul])
+			// Entries are padded with 1 to 8 NUL bytes to a multiple of 8 bytes.
+			pos = start + (pos+nul-start+8)&^7
+		}
+		previous = path
+
+		if existing, ok := index.entries[path]; ok && existing.stage != 0 {
+			continue
+		}
+		index.entries[path] = entry
+	}
+	return index, nil
+}
+
+// gitOffsetVarint decodes the variable-length integers of pack offsets and index paths, returning the
+// number of bytes read, or 0 if the data is truncated.
+func gitOffsetVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	value := int(c & 0x7f)
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		value = ((value + 1) << 7) | int(c&0x7f)
+	}
+	return value, n
+}
+
+// objectHeader returns the value of a header of a commit or tag object.
+func objectHeader(data []byte, name string) (string, bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, name+" "); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// readObject reads an object from the loose objects or the packs of the repository.
+func (r *gitRepository) readObject(sha string) (string, []byte, error) {
+	if len(sha) != 2*r.hashLen {
+		return "", nil, fmt.Errorf("invalid object name %q", sha)
+	}
+	objects := filepath.Join(r.commonDir, "objects")
+	f, err := os.Open(filepath.Join(objects, sha[:2], sha[2:]))
+	if err == nil {
+		defer f.Close()
+		return readLooseObject(sha, f)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, err
+	}
+
+	raw, err := hex.DecodeString(sha)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid object name %q", sha)
+	}
+	indexes, err := filepath.Glob(filepath.Join(objects, "pack", "*.idx"))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, idx := range indexes {
+		offset, found, err := r.findPackedObject(idx, raw)
+		if err != nil {
+			return "", nil, err
+		}
+		if found {
+			return r.readPackedObject(strings.TrimSuffix(idx, ".idx")+".pack", offset)
+		}
+	}
+	return "", nil, fmt.Errorf("object %s not found", sha)
+}
+
+func readLooseObject(sha string, f io.Reader) (string, []byte, error) {
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading object %s: %w", sha, err)
+	}
+	defer z.Close()
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading object %s: %w", sha, err)
+	}
+	header, content, ok := bytes.Cut(data, []byte{0})
+	kind, _, _ := strings.Cut(string(header), " ")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid object %s", sha)
+	}
+	return kind, content, nil
+}
+
+// findPackedObject looks up the offset of an object in a version 2 pack index.
+func (r *gitRepository) findPackedObject(idx string, sha []byte) (int64, bool, error) {
+	data, err := os.ReadFile(filepath.Clean(idx))
+	if err != nil {
+		return 0, false, err
+	}
+	invalid := fmt.Errorf("invalid pack index %s", idx)
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) ||
+		binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return 0, false, invalid
+	}
+	fanout := func(i int) int { return int(binary.BigEndian.Uint32(data[8+4*i:])) }
+	count := fanout(255)
+	names := 8 + 256*4
+	crcs := names + count*r.hashLen
+	offsets := crcs + count*4
+	largeOffsets := offsets + count*4
+	if len(data) < largeOffsets {
+		return 0, false, invalid
+	}
+
+	lo := 0
+	if sha[0] > 0 {
+		lo = fanout(int(sha[0]) - 1)
+	}
+	hi := fanout(int(sha[0]))
+	for lo < hi {
+		mid := (lo + hi) / 2
+		name := data[names+mid*r.hashLen : names+(mid+1)*r.hashLen]
+		switch cmp := bytes.Compare(name, sha); {
+		case cmp == 0:
+			offset := binary.BigEndian.Uint32(data[offsets+mid*4:])
+			if offset&0x80000000 == 0 {
+				return int64(offset), true, nil
+			}
+			large := largeOffsets + int(offset&0x7fffffff)*8
+			if len(data) < large+8 {
+				return 0, false, invalid
+			}
+			return int64(binary.BigEndian.Uint64(data[large:])), true, nil
+		case cmp < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false, nil
+}
+
+var gitObjectKinds = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+// readPackedObject reads the object at an offset of a pack, applying deltas.
+func (r *gitRepository) readPackedObject(pack string, offset int64) (string, []byte, error) {
+	f, err := os.Open(filepath.Clean(pack))
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	return r.readPackEntry(f, pack, offset, 0)
+}
+
+func (r *gitRepository) readPackEntry(f *os.File, pack string, offset int64, depth int) (string, []byte, error) {
+	if depth > 50 {
+		return "", nil, fmt.Errorf("delta chain too long in pack %s", pack)
+	}
+	rd := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	c, err := rd.ReadByte()
+	if err != nil {
+		return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+	}
+	kind := (c >> 4) & 7
+	for c&0x80 != 0 {
+		if c, err = rd.ReadByte(); err != nil {
+			return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+		}
+	}
+
+	var baseKind string
+	var base []byte
+	switch kind {
+	case 6: // offset delta
+		var header [10]byte
+		n := 0
+		for {
+			if header[n], err = rd.ReadByte(); err != nil {
+				return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+			}
+			n++
+			if header[n-1]&0x80 == 0 || n == len(header) {
+				break
+			}
+		}
+		distance, _ := gitOffsetVarint(header[:n])
+		baseKind, base, err = r.readPackEntry(f, pack, offset-int64(distance), depth+1)
+	case 7: // reference delta
+		sha := make([]byte, r.hashLen)
+		if _, err := io.ReadFull(rd, sha); err != nil {
+			return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+		}
+		baseKind, base, err = r.readObject(hex.EncodeToString(sha))
+	default:
+		if _, ok := gitObjectKinds[kind]; !ok {
+			return "", nil, fmt.Errorf("invalid object type %d in pack %s", kind, pack)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	z, err := zlib.NewReader(rd)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+	}
+	defer z.Close()
+	data, err := io.ReadAll(z)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+	}
+	if base == nil {
+		return gitObjectKinds[kind], data, nil
+	}
+	patched, err := applyGitDelta(base, data)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading pack %s: %w", pack, err)
+	}
+	return baseKind, patched, nil
+}
+
+// applyGitDelta applies a delta of a pack to its base object.
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	invalid := errors.New("invalid delta")
+	varint := func() (int, bool) {
+		value, shift := 0, 0
+		for len(delta) > 0 {
+			c := delta[0]
+			delta = delta[1:]
+			value |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return value, true
+			}
+		}
+		return 0, false
+	}
+	baseSize, ok1 := varint()
+	size, ok2 := varint()
+	if !ok1 || !ok2 || baseSize != len(base) {
+		return nil, invalid
+	}
+
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var offset, n int
+			for i := range 7 {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, invalid
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					n |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if offset+n > len(base) {
+				return nil, invalid
+			}
+			out = append(out, base[offset:offset+n]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, invalid
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, invalid
+		}
+	}
+	if len(out) != size {
+		return nil, invalid
+	}
+	return out, nil
+}
+
+// gitConfig holds the entries of a git config file, in order. Section and key names are lowercase.
+type gitConfig []gitConfigEntry
+
+type gitConfigEntry struct {
+	section    string
+	subsection string
+	key        string
+	value      string
+}
+
+func (c gitConfig) get(section, subsection, key string) string {
+	value := ""
+	for _, entry := range c {
+		if entry.section == section && entry.subsection == subsection && entry.key == key {
+			value = entry.value
+		}
+	}
+	return value
+}
+
+// readGitConfig reads the entries of a git config file. Includes are not followed.
+func readGitConfig(file string) (gitConfig, error) {
+	content, err := os.ReadFile(filepath.Clean(file))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config gitConfig
+	var section, subsection string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			header, _, _ := strings.Cut(line[1:], "]")
+			name, sub, hasSub := strings.Cut(header, " ")
+			section, subsection = strings.ToLower(name), ""
+			if hasSub {
+				subsection = strings.Trim(strings.TrimSpace(sub), `"`)
+			} else if dot := strings.Index(name, "."); dot >= 0 {
+				section, subsection = strings.ToLower(name[:dot]), name[dot+1:]
+			}
+			continue
+		}
+		key, value, hasValue := strings.Cut(line, "=")
+		entry := gitConfigEntry{
+			section:    section,
+			subsection: subsection,
+			key:        strings.ToLower(strings.TrimSpace(key)),
+			value:      "true",
+		}
+		if hasValue {
+			entry.value = gitConfigValue(value)
+		}
+		config = append(config, entry)
+	}
+	return config, nil
+}
+
+// gitConfigValue removes the quotes, escapes and comments of a config value.
+func gitConfigValue(raw string) string {
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(raw[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
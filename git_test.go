@@ -0,0 +1,231 @@
+package expression_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func gitCommand(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func newGitRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	gitCommand(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("creating directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+}
+
+func evaluateGit(t *testing.T, dir, ex string) interface{} {
+	t.Helper()
+	data, err := expression.NewData(context.Background(), expression.WithGitNamespace(dir))
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	result, err := expression.Evaluate(ex, data)
+	if err != nil {
+		t.Fatalf("expected no error evaluating %s, got %v", ex, err)
+	}
+	return result
+}
+
+func TestGitNamespace(t *testing.T) {
+	dir := newGitRepository(t)
+
+	if branch := evaluateGit(t, dir, `git.branch`); branch != "main" {
+		t.Errorf("expected branch main before the first commit, got %v", branch)
+	}
+	if sha := evaluateGit(t, dir, `git.sha`); sha != "" {
+		t.Errorf("expected empty sha before the first commit, got %v", sha)
+	}
+
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	writeFile(t, filepath.Join(dir, "sub", "b.txt"), "b\n")
+	gitCommand(t, dir, "add", ".")
+	gitCommand(t, dir, "commit", "-q", "-m", "initial")
+	gitCommand(t, dir, "tag", "v1.0.0")
+	gitCommand(t, dir, "tag", "-a", "-m", "release", "v1.0.0-annotated")
+	gitCommand(t, dir, "remote", "add", "origin", "https://example.com/repo.git")
+	head := gitCommand(t, dir, "rev-parse", "HEAD")
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatalf("resolving directory: %v", err)
+	}
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"branch", `git.branch`, "main"},
+		{"sha", `git.sha`, head},
+		{"short sha", `git.shortSha`, head[:7]},
+		{"tag", `git.tag`, "v1.0.0"},
+		{"tags", `git.tags`, []string{"v1.0.0", "v1.0.0-annotated"}},
+		{"dirty", `git.dirty`, false},
+		{"changed files", `git.changedFiles`, []string{}},
+		{"remote url", `git.remoteUrl`, "https://example.com/repo.git"},
+		{"dynamic field", `git["branch"] == "main"`, true},
+		{"whole namespace", `git.sha == git.sha && len(keys(git)) > 0`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := evaluateGit(t, filepath.Join(root, "sub"), test.expr)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	if result := evaluateGit(t, filepath.Join(root, "sub"), `git.root`); result != root {
+		t.Errorf("expected root %s, got %v", root, result)
+	}
+}
+
+func TestGitNamespaceChanges(t *testing.T) {
+	dir := newGitRepository(t)
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b\n")
+	writeFile(t, filepath.Join(dir, "c.txt"), "c\n")
+	gitCommand(t, dir, "add", ".")
+	gitCommand(t, dir, "commit", "-q", "-m", "initial")
+
+	writeFile(t, filepath.Join(dir, "untracked.txt"), "untracked\n")
+	if dirty := evaluateGit(t, dir, `git.dirty`); dirty != false {
+		t.Errorf("expected untracked files to be ignored, got dirty %v", dirty)
+	}
+
+	writeFile(t, filepath.Join(dir, "a.txt"), "modified\n")
+	writeFile(t, filepath.Join(dir, "new.txt"), "new\n")
+	gitCommand(t, dir, "add", "new.txt")
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatalf("removing file: %v", err)
+	}
+
+	expected := []string{"a.txt", "b.txt", "new.txt"}
+	if changed := evaluateGit(t, dir, `git.changedFiles`); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected changed files %v, got %v", expected, changed)
+	}
+	if dirty := evaluateGit(t, dir, `git.dirty`); dirty != true {
+		t.Errorf("expected dirty repository, got %v", dirty)
+	}
+}
+
+func TestGitNamespacePacked(t *testing.T) {
+	dir := newGitRepository(t)
+	var content strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&content, "line %d of a file that changes a little in each commit\n", i)
+		writeFile(t, filepath.Join(dir, "file.txt"), content.String())
+		writeFile(t, filepath.Join(dir, "dir", fmt.Sprintf("f%d.txt", i%3)), content.String())
+		gitCommand(t, dir, "add", ".")
+		gitCommand(t, dir, "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+	gitCommand(t, dir, "tag", "-a", "-m", "release", "v2")
+	gitCommand(t, dir, "gc", "-q", "--aggressive")
+	gitCommand(t, dir, "checkout", "-q", "--detach", "HEAD~1")
+	gitCommand(t, dir, "tag", "-a", "-m", "loose", "v1")
+	head := gitCommand(t, dir, "rev-parse", "HEAD")
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"detached branch", `git.branch`, ""},
+		{"sha", `git.sha`, head},
+		{"tags", `git.tags`, []string{"v1"}},
+		{"dirty", `git.dirty`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := evaluateGit(t, dir, test.expr)
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	gitCommand(t, dir, "checkout", "-q", "main")
+	if tags := evaluateGit(t, dir, `git.tags`); !reflect.DeepEqual(tags, []string{"v2"}) {
+		t.Errorf("expected packed annotated tag, got %v", tags)
+	}
+	writeFile(t, filepath.Join(dir, "dir", "f1.txt"), "changed\n")
+	if changed := evaluateGit(t, dir, `git.changedFiles`); !reflect.DeepEqual(changed, []string{"dir/f1.txt"}) {
+		t.Errorf("expected changed file in packed tree, got %v", changed)
+	}
+}
+
+func TestGitNamespaceWorktree(t *testing.T) {
+	dir := newGitRepository(t)
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	gitCommand(t, dir, "add", ".")
+	gitCommand(t, dir, "commit", "-q", "-m", "initial")
+	worktree := filepath.Join(t.TempDir(), "worktree")
+	gitCommand(t, dir, "worktree", "add", "-q", "-b", "feature", worktree)
+
+	if branch := evaluateGit(t, worktree, `git.branch`); branch != "feature" {
+		t.Errorf("expected worktree branch feature, got %v", branch)
+	}
+	if dirty := evaluateGit(t, worktree, `git.dirty`); dirty != false {
+		t.Errorf("expected clean worktree, got dirty %v", dirty)
+	}
+}
+
+func TestGitNamespaceErrors(t *testing.T) {
+	data, err := expression.NewData(context.Background(), expression.WithGitNamespace(t.TempDir()))
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	if _, err := expression.Evaluate(`git.branch`, data); err == nil ||
+		!strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("expected not a git repository error, got %v", err)
+	}
+	if _, err := expression.Evaluate(`git.unknown`, data); err == nil ||
+		!strings.Contains(err.Error(), `git has no field "unknown"`) {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+
+	data, err = expression.BuildData(context.Background(), nil, "git", "variable")
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	if result, err := expression.Evaluate(`git`, data); err != nil || result != "variable" {
+		t.Errorf("expected git to be a plain variable without the namespace, got %v, %v", result, err)
+	}
+}
@@ -3,11 +3,11 @@ module github.com/jahvon/expression
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/expr-lang/expr v1.17.5
+	go.yaml.in/yaml/v3 v3.0.4
+	golang.org/x/sys v0.35.0
 	mvdan.cc/sh/v3 v3.12.0
 )
 
-require (
-	golang.org/x/sys v0.35.0 // indirect
-	golang.org/x/term v0.34.0 // indirect
-)
+require golang.org/x/term v0.34.0 // indirect
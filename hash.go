@@ -0,0 +1,176 @@
+package expression
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr"
+)
+
+// hashAlgorithms are the algorithms of the hashing functions, by name.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// hashFunctions returns the functions hashing files.
+func hashFunctions(s *session, ex string) []expr.Option {
+	return []expr.Option{
+		fileFunction(s, ex, "sha256File", func(path string) (string, error) {
+			return hashFile(path, sha256.New)
+		}),
+		fileFunction(s, ex, "sha1File", func(path string) (string, error) {
+			return hashFile(path, sha1.New)
+		}),
+		fileFunction(s, ex, "md5File", func(path string) (string, error) {
+			return hashFile(path, md5.New)
+		}),
+		expr.Function("hashDir", func(params ...interface{}) (interface{}, error) {
+			dir, opts, err := pathAndOptions("hashDir", params, []string{"algorithm"})
+			if err != nil {
+				return nil, err
+			}
+			algorithm := "sha256"
+			if value, ok := opts["algorithm"]; ok {
+				if algorithm, ok = value.(string); !ok || hashAlgorithms[algorithm] == nil {
+					return nil, fmt.Errorf("hashDir() option \"algorithm\" must be sha256, sha1 or md5, got %v", value)
+				}
+			}
+			return fileCall(s, ex, "hashDir", dir, opts, func() (string, error) {
+				return hashDir(dir, hashAlgorithms[algorithm])
+			})
+		}),
+		expr.Function("verifyChecksum", func(params ...interface{}) (interface{}, error) {
+			file, sumsFile, err := twoStringArgs("verifyChecksum", params)
+			if err != nil {
+				return nil, err
+			}
+			return fileCall(s, ex, "verifyChecksum", file, options{"sumsFile": sumsFile}, func() (bool, error) {
+				return verifyChecksum(file, sumsFile)
+			})
+		}),
+	}
+}
+
+// hashFile returns the hex digest of a file, reading it as a stream.
+func hashFile(path string, newHash func() hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir returns the hex digest of a directory tree: the digest of the lines `<digest>  <path>` of its files,
+// as written by sha256sum, sorted by path. Paths are relative to the directory and use forward slashes, so that
+// the digest does not depend on the location of the directory or on the platform. Symbolic links are hashed
+// by their target rather than followed.
+func hashDir(dir string, newHash func() hash.Hash) (string, error) {
+	sums := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var sum string
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			h := newHash()
+			_, _ = io.WriteString(h, filepath.ToSlash(target))
+			sum = hex.EncodeToString(h.Sum(nil))
+		} else if sum, err = hashFile(path, newHash); err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	paths := make([]string, 0, len(sums))
+	for path := range sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	h := newHash()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s  %s\n", sums[path], path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksum reports whether a file matches its checksum in a file written by sha256sum, sha1sum or
+// md5sum, the algorithm being inferred from the length of the checksum. The file is looked up by its path as
+// given, or relative to the directory of the checksums file.
+func verifyChecksum(file, sumsFile string) (bool, error) {
+	f, err := os.Open(sumsFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	wanted := filepath.Clean(file)
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(text, " ")
+		if !ok {
+			return false, fmt.Errorf("%s:%d: invalid checksum line", sumsFile, line)
+		}
+		// A `*` marks files hashed in binary mode, which makes no difference for the digest.
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if filepath.Clean(name) != wanted && filepath.Join(filepath.Dir(sumsFile), name) != wanted {
+			continue
+		}
+
+		var newHash func() hash.Hash
+		switch len(sum) {
+		case 2 * sha256.Size:
+			newHash = sha256.New
+		case 2 * sha1.Size:
+			newHash = sha1.New
+		case 2 * md5.Size:
+			newHash = md5.New
+		default:
+			return false, fmt.Errorf("%s:%d: unknown checksum length %d", sumsFile, line, len(sum))
+		}
+		actual, err := hashFile(file, newHash)
+		if err != nil {
+			return false, err
+		}
+		return strings.EqualFold(actual, sum), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("reading %s: %w", sumsFile, err)
+	}
+	return false, fmt.Errorf("%s has no checksum for %s", sumsFile, file)
+}
@@ -0,0 +1,92 @@
+package expression_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestHashFunctions(t *testing.T) {
+	root := newFileTree(t, "tree/a.txt", "tree/sub/b.txt")
+	other := filepath.Join(t.TempDir(), "tree")
+	writeFile(t, filepath.Join(other, "a.txt"), "tree/a.txt")
+	writeFile(t, filepath.Join(other, "sub/b.txt"), "tree/sub/b.txt")
+	file := filepath.Join(root, "hello.txt")
+	writeFile(t, file, "hello\n")
+
+	// Digests of "hello\n", as printed by sha256sum, sha1sum and md5sum.
+	sha256Sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	sha1Sum := "f572d396fae9206628714fb2ce00f72e94f2258f"
+	md5Sum := "b1946ac92492d2347c6235b4d2611184"
+	writeFile(t, filepath.Join(root, "SHA256SUMS"),
+		sha256Sum+"  hello.txt\n"+strings.Repeat("0", 64)+" *tree/a.txt\n"+md5Sum+"  "+file+"\n")
+
+	data := map[string]interface{}{"root": root, "file": file, "other": other}
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"sha256File", `sha256File(file)`, sha256Sum},
+		{"sha1File", `sha1File(file)`, sha1Sum},
+		{"md5File", `md5File(file)`, md5Sum},
+		{"hashDir independent of location", `hashDir(root + "/tree") == hashDir(other)`, true},
+		{"hashDir algorithm", `len(hashDir(other, {algorithm: "md5"}))`, 32},
+		{"hashDir changes with content", `hashDir(root + "/tree") == hashDir(root)`, false},
+		{"verifyChecksum relative to sums file", `verifyChecksum(file, root + "/SHA256SUMS")`, true},
+		{"verifyChecksum mismatch", `verifyChecksum(root + "/tree/a.txt", root + "/SHA256SUMS")`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	before, err := expression.Evaluate(`hashDir(other)`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(other, "sub/b.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to change file: %v", err)
+	}
+	if after, err := expression.Evaluate(`hashDir(other)`, data); err != nil || after == before {
+		t.Errorf("expected the hash to change with the content, got %v and %v (%v)", before, after, err)
+	}
+}
+
+func TestHashFunctionErrors(t *testing.T) {
+	root := newFileTree(t, "a.txt")
+	writeFile(t, filepath.Join(root, "SUMS"), "abc  a.txt\nnot-a-checksum-line\n")
+	data := map[string]interface{}{"root": root}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"missing file", `sha256File(root + "/missing")`, "no such file"},
+		{"unknown algorithm", `hashDir(root, {algorithm: "crc32"})`, "must be sha256, sha1 or md5"},
+		{"invalid checksum", `verifyChecksum(root + "/a.txt", root + "/SUMS")`, "SUMS:1: unknown checksum length 3"},
+		{"missing entry", `verifyChecksum(root + "/b.txt", root + "/SUMS")`, "SUMS:2: invalid checksum line"},
+		{"wrong arguments", `verifyChecksum(root)`, "takes exactly 2 arguments"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.Evaluate(test.expr, data)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
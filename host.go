@@ -0,0 +1,200 @@
+package expression
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// WithHostNamespaces sets the `host` and `user` namespaces describing the machine and the user running the
+// expressions. Their fields are computed when first accessed.
+//
+// `host` fields:
+// - `name`: the hostname
+// - `cwd`: the working directory
+// - `cpus`: the number of logical CPUs
+// - `memory`: the total memory in bytes
+// - `distro`, `distroVersion` and `distroName`: the `ID`, `VERSION_ID` and `PRETTY_NAME` of `/etc/os-release`,
+// empty on systems without it
+// - `container`: whether the process runs in a container
+// - `ci`: whether the process runs in a CI system, and `ciProvider` its name (e.g. "github-actions")
+//
+// `user` fields:
+// - `name`: the username
+// - `home`: the home directory
+// - `uid` and `gid`: the user and group IDs, as numbers on Unix systems
+func WithHostNamespaces() Option {
+	return func(s *session) {
+		if s.namespaces == nil {
+			s.namespaces = make(map[string]*namespace)
+		}
+		release := &osRelease{}
+		s.namespaces["host"] = newNamespace("", map[string]func() (interface{}, error){
+			"name":          func() (interface{}, error) { return os.Hostname() },
+			"cwd":           func() (interface{}, error) { return os.Getwd() },
+			"cpus":          func() (interface{}, error) { return runtime.NumCPU(), nil },
+			"memory":        func() (interface{}, error) { return totalMemory() },
+			"distro":        func() (interface{}, error) { return release.field("ID") },
+			"distroVersion": func() (interface{}, error) { return release.field("VERSION_ID") },
+			"distroName":    func() (interface{}, error) { return release.field("PRETTY_NAME") },
+			"container":     func() (interface{}, error) { return inContainer(), nil },
+			"ci":            func() (interface{}, error) { return ciProvider() != "", nil },
+			"ciProvider":    func() (interface{}, error) { return ciProvider(), nil },
+		})
+
+		current := &currentUser{}
+		s.namespaces["user"] = newNamespace("", map[string]func() (interface{}, error){
+			"name": func() (interface{}, error) { return current.lookup().Username, nil },
+			"home": func() (interface{}, error) { return current.lookup().HomeDir, nil },
+			"uid":  func() (interface{}, error) { return numericID(current.lookup().Uid), nil },
+			"gid":  func() (interface{}, error) { return numericID(current.lookup().Gid), nil },
+		})
+	}
+}
+
+// osRelease holds the fields of the os-release file, read on first use.
+type osRelease struct {
+	fields map[string]string
+	err    error
+}
+
+func (r *osRelease) field(name string) (string, error) {
+	if r.fields == nil && r.err == nil {
+		r.fields, r.err = readOSRelease()
+	}
+	return r.fields[name], r.err
+}
+
+// readOSRelease reads `/etc/os-release`, or `/usr/lib/os-release` when it is missing. Missing files are
+// not an error, since systems other than Linux do not have them.
+func readOSRelease() (map[string]string, error) {
+	fields := make(map[string]string)
+	for _, file := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		content, err := os.ReadFile(filepath.Clean(file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if !ok || strings.HasPrefix(key, "#") {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(value, `'"`)
+			}
+			fields[key] = value
+		}
+		break
+	}
+	return fields, nil
+}
+
+// currentUser holds the user running the process, looked up on first use. When the user database is
+// unavailable, such as in containers running as an unnamed user, the user is described from the environment.
+type currentUser struct {
+	user *user.User
+}
+
+func (c *currentUser) lookup() *user.User {
+	if c.user == nil {
+		u, err := user.Current()
+		if err != nil {
+			home, _ := os.UserHomeDir()
+			u = &user.User{
+				Username: firstEnv("USER", "USERNAME", "LOGNAME"),
+				HomeDir:  home,
+				Uid:      strconv.Itoa(os.Getuid()),
+				Gid:      strconv.Itoa(os.Getgid()),
+			}
+		}
+		c.user = u
+	}
+	return c.user
+}
+
+// numericID returns Unix user and group IDs as numbers, and other IDs, such as Windows SIDs, as is.
+func numericID(id string) interface{} {
+	if n, err := strconv.Atoi(id); err == nil {
+		return n
+	}
+	return id
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// inContainer reports whether the process runs in a container, from the marker files of container runtimes,
+// the environment, and the control groups of the process.
+func inContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	if os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	f, err := os.Open("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, name := range []string{"docker", "kubepods", "containerd", "lxc", "libpod"} {
+			if strings.Contains(line, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ciProviders maps environment variables set by CI systems to their name.
+var ciProviders = []struct {
+	env  string
+	name string
+}{
+	{"GITHUB_ACTIONS", "github-actions"},
+	{"GITLAB_CI", "gitlab"},
+	{"CIRCLECI", "circleci"},
+	{"TRAVIS", "travis"},
+	{"JENKINS_URL", "jenkins"},
+	{"BUILDKITE", "buildkite"},
+	{"TF_BUILD", "azure-pipelines"},
+	{"TEAMCITY_VERSION", "teamcity"},
+	{"BITBUCKET_BUILD_NUMBER", "bitbucket"},
+	{"CODEBUILD_BUILD_ID", "codebuild"},
+	{"DRONE", "drone"},
+}
+
+// ciProvider returns the name of the CI system running the process, "unknown" for other CI systems setting
+// `CI`, or an empty string outside CI.
+func ciProvider() string {
+	for _, provider := range ciProviders {
+		if os.Getenv(provider.env) != "" {
+			return provider.name
+		}
+	}
+	if ci := strings.ToLower(os.Getenv("CI")); ci != "" && ci != "false" && ci != "0" {
+		return "unknown"
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package expression_test
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestHostNamespaces(t *testing.T) {
+	data, err := expression.NewData(context.Background(), expression.WithHostNamespaces())
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("getting hostname: %v", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting working directory: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"hostname", `host.name`, hostname},
+		{"cwd", `host.cwd`, cwd},
+		{"cpus", `host.cpus`, runtime.NumCPU()},
+		{"container", `host.container in [true, false]`, true},
+		{"user uid", `type(user.uid) in ["int", "string"]`, true},
+	}
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		tests = append(tests, struct {
+			name     string
+			expr     string
+			expected interface{}
+		}{"memory", `host.memory > 0`, true})
+	}
+	if u, err := user.Current(); err == nil {
+		tests = append(tests, []struct {
+			name     string
+			expr     string
+			expected interface{}
+		}{
+			{"user name", `user.name`, u.Username},
+			{"user home", `user.home`, u.HomeDir},
+			{"user uid string", `string(user.uid)`, u.Uid},
+		}...)
+	}
+	if _, err := os.Stat("/etc/os-release"); err == nil {
+		tests = append(tests, struct {
+			name     string
+			expr     string
+			expected interface{}
+		}{"distro", `host.distro != "" && host.distroName != ""`, true})
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	for ex, expected := range map[string]string{
+		`$namespace()`:                  "takes 1 or 2 arguments, got 0",
+		`$namespace("host", "name", 1)`: "takes 1 or 2 arguments, got 3",
+		`$namespace("nope")`:            `unknown namespace "nope"`,
+		`$namespace("git", "branch")`:   `unknown namespace "git"`,
+	} {
+		if _, err := expression.Evaluate(ex, data); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %s to fail with %q, got %v", ex, expected, err)
+		}
+	}
+}
+
+func TestHostNamespaceCI(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		ci       bool
+		provider string
+	}{
+		{"outside ci", map[string]string{}, false, ""},
+		{"ci false", map[string]string{"CI": "false"}, false, ""},
+		{"github actions", map[string]string{"GITHUB_ACTIONS": "true", "CI": "true"}, true, "github-actions"},
+		{"generic ci", map[string]string{"CI": "1"}, true, "unknown"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{
+				"CI", "GITHUB_ACTIONS", "GITLAB_CI", "CIRCLECI", "TRAVIS", "JENKINS_URL", "BUILDKITE", "TF_BUILD",
+				"TEAMCITY_VERSION", "BITBUCKET_BUILD_NUMBER", "CODEBUILD_BUILD_ID", "DRONE",
+			} {
+				t.Setenv(name, test.env[name])
+			}
+			data, err := expression.NewData(context.Background(), expression.WithHostNamespaces())
+			if err != nil {
+				t.Fatalf("expected no error building data, got %v", err)
+			}
+			result, err := expression.Evaluate(`[host.ci, host.ciProvider]`, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := []interface{}{test.ci, test.provider}
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("expected %v, got %v", expected, result)
+			}
+		})
+	}
+}
+
+func TestHostNamespacesReplay(t *testing.T) {
+	recorder := expression.NewRecorder()
+	data, err := expression.NewData(
+		context.Background(), expression.WithHostNamespaces(), expression.WithRecorder(recorder),
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	expected, err := expression.EvaluateString(`host.name + ":" + string(host.cpus)`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	data, err = expression.NewData(
+		context.Background(), expression.WithHostNamespaces(), expression.WithReplay(recorder.Bundle()),
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	result, err := expression.EvaluateString(`host.name + ":" + string(host.cpus)`, data)
+	if err != nil {
+		t.Fatalf("expected no error replaying, got %v", err)
+	}
+	if result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+	if _, err := expression.Evaluate(`user.name`, data); err == nil {
+		t.Error("expected an error for a field that was not recorded")
+	}
+}
@@ -0,0 +1,77 @@
+package expression
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseINI parses an INI file into a map of sections, each a map of string values. Keys set before the first
+// section are set at the top level. Keys and values are separated by `=` or `:`, lines starting with `;` or
+// `#` are comments, and values can be quoted. Later keys override earlier ones, and sections appearing
+// several times are merged.
+func parseINI(r io.Reader) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	current := values
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		switch {
+		case text == "" || text[0] == ';' || text[0] == '#':
+			continue
+		case text[0] == '[':
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header", line)
+			}
+			name := strings.TrimSpace(text[1 : len(text)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty section name", line)
+			}
+			section, ok := values[name].(map[string]interface{})
+			if !ok {
+				if _, exists := values[name]; exists {
+					return nil, fmt.Errorf("line %d: section %q conflicts with the key of the same name", line, name)
+				}
+				section = make(map[string]interface{})
+				values[name] = section
+			}
+			current = section
+		default:
+			i := strings.IndexAny(text, "=:")
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: expected key = value", line)
+			}
+			key := strings.TrimSpace(text[:i])
+			if key == "" {
+				return nil, fmt.Errorf("line %d: empty key", line)
+			}
+			if _, isSection := current[key].(map[string]interface{}); isSection {
+				return nil, fmt.Errorf("line %d: key %q conflicts with the section of the same name", line, key)
+			}
+			current[key] = iniValue(strings.TrimSpace(text[i+1:]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// iniValue unquotes a value, or removes its inline comment.
+func iniValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	for _, marker := range []string{" ;", " #"} {
+		if i := strings.Index(value, marker); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,227 @@
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyPathSegment is a map key or a slice index of a key path.
+type keyPathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func (s keyPathSegment) String() string {
+	if s.isIndex {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return s.key
+}
+
+// maxKeyPathIndex is the largest index of a key path, as lists are filled with nil items up to the index.
+const maxKeyPathIndex = 9999
+
+// parseKeyPath splits a key path such as `app.servers[0].name` or `labels["app.kubernetes.io/name"]` into
+// its segments. Dots separate map keys, brackets hold slice indexes or quoted map keys.
+func parseKeyPath(path string) ([]keyPathSegment, error) {
+	var segments []keyPathSegment
+	invalid := func(msg string) error {
+		return fmt.Errorf("invalid key path %q: %s", path, msg)
+	}
+
+	i := 0
+	expectKey := true
+	for i < len(path) {
+		switch c := path[i]; {
+		case c == '[' && i+1 < len(path) && (path[i+1] == '"' || path[i+1] == '\''):
+			// Quoted keys may contain dots and brackets, so look for the closing quote first.
+			closing := strings.IndexByte(path[i+2:], path[i+1])
+			if closing < 0 || i+2+closing+1 >= len(path) || path[i+2+closing+1] != ']' {
+				return nil, invalid("unterminated quoted key")
+			}
+			segments = append(segments, keyPathSegment{key: path[i+2 : i+2+closing]})
+			i += 2 + closing + 2
+			expectKey = false
+		case c == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, invalid("unterminated bracket")
+			}
+			inner := path[i+1 : i+end]
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, invalid(fmt.Sprintf("invalid index %q", inner))
+			}
+			if index > maxKeyPathIndex {
+				return nil, invalid(fmt.Sprintf("index %d exceeds the maximum of %d", index, maxKeyPathIndex))
+			}
+			segments = append(segments, keyPathSegment{index: index, isIndex: true})
+			i += end + 1
+			expectKey = false
+		case c == '.':
+			if expectKey {
+				return nil, invalid("empty key")
+			}
+			i++
+			expectKey = true
+		default:
+			if !expectKey {
+				return nil, invalid(fmt.Sprintf("expected '.' or '[' at offset %d", i))
+			}
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, keyPathSegment{key: path[i : i+end]})
+			i += end
+			expectKey = false
+		}
+	}
+	if expectKey {
+		return nil, invalid("empty key")
+	}
+	if segments[0].isIndex {
+		return nil, invalid("the first segment must be a key")
+	}
+	return segments, nil
+}
+
+// setKeyPath sets a value at a key path in vars, creating the nested maps and slices along the path.
+// Maps and slices along the path are copied rather than modified, since they may belong to the caller.
+// Paths going through a value that is neither a map nor a slice are reported as conflicts.
+func setKeyPath(vars map[string]interface{}, path string, value interface{}) error {
+	if !strings.ContainsAny(path, ".[") {
+		vars[path] = value
+		return nil
+	}
+	segments, err := parseKeyPath(path)
+	if err != nil {
+		return err
+	}
+	root := segments[0].key
+	updated, err := setKeyPathSegments(vars[root], segments[1:], value, segments[:1], path)
+	if err != nil {
+		return err
+	}
+	vars[root] = updated
+	return nil
+}
+
+// setKeyPathSegments returns a copy of current with the value set at the remaining segments of the path.
+// visited are the segments leading to current.
+func setKeyPathSegments(
+	current interface{}, segments []keyPathSegment, value interface{}, visited []keyPathSegment, path string,
+) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	segment := segments[0]
+	next := append(visited[:len(visited):len(visited)], segment)
+
+	if segment.isIndex {
+		var list []interface{}
+		switch v := reflect.ValueOf(current); {
+		case current == nil:
+		case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+			list = make([]interface{}, v.Len())
+			for i := range list {
+				list[i] = v.Index(i).Interface()
+			}
+		default:
+			return nil, keyPathConflict(path, visited, current, "list")
+		}
+		for len(list) <= segment.index {
+			list = append(list, nil)
+		}
+		updated, err := setKeyPathSegments(list[segment.index], segments[1:], value, next, path)
+		if err != nil {
+			return nil, err
+		}
+		list[segment.index] = updated
+		return list, nil
+	}
+
+	m := make(map[string]interface{})
+	switch v := reflect.ValueOf(current); {
+	case current == nil:
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+	default:
+		return nil, keyPathConflict(path, visited, current, "map")
+	}
+	updated, err := setKeyPathSegments(m[segment.key], segments[1:], value, next, path)
+	if err != nil {
+		return nil, err
+	}
+	m[segment.key] = updated
+	return m, nil
+}
+
+func keyPathConflict(path string, visited []keyPathSegment, current interface{}, expected string) error {
+	var prefix strings.Builder
+	for i, segment := range visited {
+		if i > 0 && !segment.isIndex {
+			prefix.WriteByte('.')
+		}
+		prefix.WriteString(segment.String())
+	}
+	return fmt.Errorf("key path %q conflicts with %s, which holds a %T instead of a %s",
+		path, prefix.String(), current, expected)
+}
+
+// setKeyPaths sets the values of a map of key paths in vars, in the order of the paths, so that conflicts
+// are reported deterministically.
+func setKeyPaths(vars map[string]interface{}, values map[string]interface{}) []error {
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for _, path := range paths {
+		if err := setKeyPath(vars, path, values[path]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// getKeyPath returns the value at a key path in vars, and whether it exists.
+func getKeyPath(vars map[string]interface{}, path string) (interface{}, bool, error) {
+	if !strings.ContainsAny(path, ".[") {
+		value, ok := vars[path]
+		return value, ok, nil
+	}
+	segments, err := parseKeyPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	var current interface{} = vars
+	for _, segment := range segments {
+		v := reflect.ValueOf(current)
+		switch {
+		case segment.isIndex && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+			if segment.index >= v.Len() {
+				return nil, false, nil
+			}
+			current = v.Index(segment.index).Interface()
+		case !segment.isIndex && v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+			item := v.MapIndex(reflect.ValueOf(segment.key).Convert(v.Type().Key()))
+			if !item.IsValid() {
+				return nil, false, nil
+			}
+			current = item.Interface()
+		default:
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
@@ -0,0 +1,115 @@
+package expression_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestBuildDataKeyPaths(t *testing.T) {
+	existing := map[string]interface{}{"name": "existing", "port": 80}
+	data, err := expression.BuildData(context.Background(), nil,
+		"app.name", "web",
+		"app.labels.tier", "frontend",
+		`app.labels["app.kubernetes.io/name"]`, "web",
+		"servers[1].host", "two",
+		"servers[0].host", "one",
+		"servers[1].ports[0]", 8080,
+		"db", existing,
+		"db.port", 5432,
+		"plain", "value",
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"nested map", `app.name`, "web"},
+		{"deeply nested map", `app.labels.tier`, "frontend"},
+		{"quoted key", `app.labels["app.kubernetes.io/name"]`, "web"},
+		{"list", `map(servers, .host)`, []interface{}{"one", "two"}},
+		{"nested list", `servers[1].ports[0]`, 8080},
+		{"merged into existing map", `db.name + ":" + string(db.port)`, "existing:5432"},
+		{"plain key", `plain`, "value"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	if existing["port"] != 80 {
+		t.Errorf("expected the caller's map to be unchanged, got port %v", existing["port"])
+	}
+}
+
+func TestNewDataKeyPaths(t *testing.T) {
+	data, err := expression.NewData(context.Background(), expression.WithVars(map[string]interface{}{
+		"app.name":     "web",
+		"app.replicas": 2,
+	}))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result, err := expression.EvaluateString(`app.name + ":" + string(app.replicas)`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != "web:2" {
+		t.Errorf("expected %q, got %q", "web:2", result)
+	}
+}
+
+func TestKeyPathErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		kvPairs  []interface{}
+		expected string
+	}{
+		{"map through scalar", []interface{}{"app", "web", "app.name", "x"},
+			`key path "app.name" conflicts with app, which holds a string instead of a map`},
+		{"list through scalar", []interface{}{"servers.host", "one", "servers.host[0]", "x"},
+			`key path "servers.host[0]" conflicts with servers.host, which holds a string instead of a list`},
+		{"index through map", []interface{}{"app.name", "web", "app[0]", "x"},
+			`key path "app[0]" conflicts with app`},
+		{"empty key", []interface{}{"app..name", "x"}, `invalid key path "app..name": empty key`},
+		{"trailing dot", []interface{}{"app.", "x"}, `invalid key path "app.": empty key`},
+		{"invalid index", []interface{}{"servers[x]", "x"}, `invalid index "x"`},
+		{"large index", []interface{}{"a[2000000000]", 1}, "index 2000000000 exceeds the maximum of 9999"},
+		{"overflowing index", []interface{}{"a[99999999999999999999]", 1}, `invalid index "99999999999999999999"`},
+		{"unterminated bracket", []interface{}{"servers[0", "x"}, "unterminated bracket"},
+		{"unterminated quote", []interface{}{`labels["name]`, "x"}, "unterminated quoted key"},
+		{"leading index", []interface{}{"[0].name", "x"}, "the first segment must be a key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.BuildData(context.Background(), nil, test.kvPairs...)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+
+	_, err := expression.NewData(context.Background(), expression.WithVars(map[string]interface{}{
+		"app":      "web",
+		"app.name": "x",
+	}))
+	if err == nil || !strings.Contains(err.Error(), `key path "app.name" conflicts with app`) {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+}
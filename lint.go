@@ -0,0 +1,104 @@
+package expression
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// LintWarning describes a potential problem found in an expression by Lint.
+type LintWarning struct {
+	// Position is the character offset of the offending node in the expression.
+	Position int
+	Message  string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%d: %s", w.Position, w.Message)
+}
+
+// Lint parses an expression and reports patterns that are likely to be unsafe.
+// Currently, it warns when the `$` function (or one of its parsing variants) or a command of `parallel` receives a
+// command that is built by concatenating non-literal values, since data containing spaces or shell metacharacters
+// can break or hijack the command. Use `run(name, args)` or `shellQuote(value)` instead. It also warns when the
+// program name of `run` is concatenated from non-literal values, which lets data choose the program to run.
+//
+// Lint only sees the expression, so it assumes the default names of the built-in functions: calls of built-ins
+// renamed with WithBuiltinName are not checked, and data functions named like a built-in are.
+func Lint(ex string) ([]LintWarning, error) {
+	tree, err := parser.Parse(ex)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{}
+	ast.Walk(&tree.Node, l)
+	return l.warnings, nil
+}
+
+type linter struct {
+	warnings []LintWarning
+}
+
+func (l *linter) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok || len(call.Arguments) == 0 {
+		return
+	}
+	ident, ok := call.Callee.(*ast.IdentifierNode)
+	if !ok {
+		return
+	}
+
+	switch {
+	case isCommandFunction(ident.Value):
+		l.checkCommand(call.Arguments[0], call.Location().From, ident.Value+"() command")
+	case ident.Value == "parallel":
+		if commands, ok := call.Arguments[0].(*ast.ArrayNode); ok {
+			for _, command := range commands.Nodes {
+				l.checkCommand(command, command.Location().From, "parallel() command")
+			}
+		}
+	case ident.Value == "run":
+		if !isSafeConcat(call.Arguments[0]) {
+			l.warnings = append(l.warnings, LintWarning{
+				Position: call.Location().From,
+				Message: "run() program name is concatenated from non-literal values; " +
+					"pass the variable parts as arguments instead",
+			})
+		}
+	}
+}
+
+// checkCommand warns when a command is concatenated from non-literal values.
+func (l *linter) checkCommand(node ast.Node, position int, what string) {
+	if !isSafeConcat(node) {
+		l.warnings = append(l.warnings, LintWarning{
+			Position: position,
+			Message: what + " is concatenated from non-literal values; " +
+				"use run(name, args) or shellQuote() to avoid command injection",
+		})
+	}
+}
+
+// isSafeConcat reports whether a node is not a concatenation, or only concatenates literals and quoted values.
+func isSafeConcat(node ast.Node) bool {
+	concat, ok := node.(*ast.BinaryNode)
+	return !ok || concat.Operator != "+" || isLiteralConcat(concat)
+}
+
+// isLiteralConcat reports whether a node only concatenates string literals and quoted values.
+func isLiteralConcat(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.StringNode:
+		return true
+	case *ast.CallNode:
+		ident, ok := n.Callee.(*ast.IdentifierNode)
+		return ok && ident.Value == "shellQuote"
+	case *ast.BinaryNode:
+		return n.Operator == "+" && isLiteralConcat(n.Left) && isLiteralConcat(n.Right)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,47 @@
+package expression_test
+
+import (
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		warnings int
+	}{
+		{"literal command", `$("git status")`, 0},
+		{"concatenated literals", `$("git " + "status")`, 0},
+		{"concatenated variable", `$("ls " + dir)`, 1},
+		{"nested concatenation", `$("ls " + dir + " | wc -l") == "1"`, 1},
+		{"quoted variable", `$("ls " + shellQuote(dir))`, 0},
+		{"variable command", `$(cmd)`, 0},
+		{"run function", `run("ls", [dir])`, 0},
+		{"multiple calls", `$("cat " + a) + $("cat " + b)`, 2},
+		{"parsing variant", `$json("kubectl get pod " + name + " -o json")`, 1},
+		{"parallel commands", `parallel(["ls " + dir, "git status", "cat " + shellQuote(file)])`, 1},
+		{"parallel variable list", `parallel(commands)`, 0},
+		{"run concatenated name", `run(bin + "/tool", ["--version"])`, 1},
+		{"run literal name", `run("/usr/bin/" + "tool", [dir])`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings, err := expression.Lint(test.expr)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(warnings) != test.warnings {
+				t.Errorf("expected %d warnings, got %v", test.warnings, warnings)
+			}
+		})
+	}
+
+	t.Run("invalid expression", func(t *testing.T) {
+		if _, err := expression.Lint(`$("ls" +`); err == nil {
+			t.Error("expected parse error, got none")
+		}
+	})
+}
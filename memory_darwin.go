@@ -0,0 +1,9 @@
+package expression
+
+import "golang.org/x/sys/unix"
+
+// totalMemory returns the total memory in bytes.
+func totalMemory() (int64, error) {
+	memory, err := unix.SysctlUint64("hw.memsize")
+	return int64(memory), err
+}
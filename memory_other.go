@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package expression
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// totalMemory returns the total memory in bytes.
+func totalMemory() (int64, error) {
+	return 0, fmt.Errorf("total memory is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,155 @@
+package expression
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+)
+
+// namespace is a built-in variable whose fields are computed on first access, so that expressions only pay
+// for the facts they use.
+type namespace struct {
+	// target identifies what the fields describe, such as the repository directory, for the audit hook
+	// and the recorded bundle.
+	target string
+	fields map[string]func() (interface{}, error)
+
+	mu     sync.Mutex
+	values map[string]namespaceValue
+}
+
+type namespaceValue struct {
+	value interface{}
+	err   error
+}
+
+func newNamespace(target string, fields map[string]func() (interface{}, error)) *namespace {
+	return &namespace{target: target, fields: fields, values: make(map[string]namespaceValue)}
+}
+
+// namespaceField returns the value of a field, computing it once. Computations are audited, and recorded or
+// served from the replay bundle, like file helpers.
+func (s *session) namespaceField(builtin, ex string, ns *namespace, field string) (interface{}, error) {
+	compute, ok := ns.fields[field]
+	if !ok {
+		return nil, fmt.Errorf("%s has no field %q", builtin, field)
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if v, ok := ns.values[field]; ok {
+		return v.value, v.err
+	}
+
+	name := builtin + "." + field
+	var result interface{}
+	var computeErr error
+	event := AuditEvent{Kind: AuditFile, Operation: name, Target: ns.target, Expression: ex}
+	err := s.audit(event, func() (int, error) {
+		if s.replay != nil {
+			result, computeErr = replayFile[interface{}](s.replay, name, s.redact(ns.target))
+		} else {
+			result, computeErr = compute()
+			if s.recorder != nil {
+				s.recordFile(name, ns.target, result, computeErr)
+			}
+		}
+		return resultSize(result), computeErr
+	})
+	if err != nil && computeErr == nil {
+		return nil, err // denied by the audit hook, which may allow it later
+	}
+	if computeErr != nil {
+		computeErr = fmt.Errorf("%s: %w", name, computeErr)
+	}
+	ns.values[field] = namespaceValue{value: result, err: computeErr}
+	return result, computeErr
+}
+
+// namespaceMap returns all the fields of a namespace, for expressions using the namespace as a whole.
+func (s *session) namespaceMap(builtin, ex string, ns *namespace) (map[string]interface{}, error) {
+	fields := make([]string, 0, len(ns.fields))
+	for field := range ns.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	m := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		value, err := s.namespaceField(builtin, ex, ns, field)
+		if err != nil {
+			return nil, err
+		}
+		m[field] = value
+	}
+	return m, nil
+}
+
+// namespaceOptions returns the options evaluating the namespaces of the session in an expression.
+func (s *session) namespaceOptions(ex string) []expr.Option {
+	names := make(map[string]string)
+	for builtin := range s.namespaces {
+		if name := s.nameOf(builtin); name != "" {
+			names[name] = builtin
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	return []expr.Option{
+		expr.Function(namespaceFunction, func(params ...interface{}) (interface{}, error) {
+			if len(params) == 0 || len(params) > 2 {
+				return nil, fmt.Errorf("%s() takes 1 or 2 arguments, got %d", namespaceFunction, len(params))
+			}
+			builtin := fmt.Sprintf("%v", params[0])
+			ns := s.namespaces[builtin]
+			if ns == nil || s.nameOf(builtin) == "" {
+				return nil, fmt.Errorf("%s(): unknown namespace %q", namespaceFunction, builtin)
+			}
+			if len(params) == 1 {
+				return s.namespaceMap(builtin, ex, ns)
+			}
+			return s.namespaceField(builtin, ex, ns, fmt.Sprintf("%v", params[1]))
+		}),
+		expr.Patch(namespacePatcher{names: names}),
+	}
+}
+
+// namespaceFunction is the function replacing accesses to namespaces.
+const namespaceFunction = "$namespace"
+
+// namespacePatcher replaces namespaces with calls to the namespace function: `git.branch` becomes
+// `$namespace("git", "branch")`, and `git` alone `$namespace("git")`. names maps the names of the
+// namespaces in the data to their built-in.
+type namespacePatcher struct {
+	names map[string]string
+}
+
+func (p namespacePatcher) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if builtin, ok := p.names[n.Value]; ok {
+			ast.Patch(node, &ast.CallNode{
+				Callee:    &ast.IdentifierNode{Value: namespaceFunction},
+				Arguments: []ast.Node{&ast.StringNode{Value: builtin}},
+			})
+		}
+	case *ast.MemberNode:
+		// Children are visited first, so the namespace identifier is already replaced.
+		call, ok := n.Node.(*ast.CallNode)
+		if !ok || len(call.Arguments) != 1 {
+			return
+		}
+		if callee, ok := call.Callee.(*ast.IdentifierNode); !ok || callee.Value != namespaceFunction {
+			return
+		}
+		ast.Patch(node, &ast.CallNode{
+			Callee:    &ast.IdentifierNode{Value: namespaceFunction},
+			Arguments: []ast.Node{call.Arguments[0], n.Property},
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// WithMaxParallel sets the maximum number of commands run concurrently by the `parallel` function and
+// by Template.Prefetch. It defaults to the number of CPUs.
+func WithMaxParallel(n int) Option {
+	return func(s *session) {
+		s.maxParallel = n
+	}
+}
+
+type prefetchResult struct {
+	result commandResult
+	err    error
+}
+
+// prefetchedResults are the results of prefetched commands, by command key. They are only read once
+// prefetched, so they need no locking.
+type prefetchedResults map[string]prefetchResult
+
+// runParallel runs the commands of a `parallel` call and returns their outputs in order.
+func (s *session) runParallel(ex string, commands []interface{}, prefetched prefetchedResults) ([]string, error) {
+	cmds := make([]command, 0, len(commands))
+	for i, c := range commands {
+		text, ok := c.(string)
+		if !ok {
+			return nil, fmt.Errorf("parallel() command %d must be a string, got %T", i, c)
+		}
+		cmds = append(cmds, command{text: text, fn: "parallel", expression: ex, prefetched: prefetched})
+	}
+
+	results, errs := s.executeAll(cmds)
+	outputs := make([]string, len(cmds))
+	var failures []error
+	for i := range cmds {
+		outputs[i] = results[i].output(errs[i])
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("command %q failed: %v, output: %s", cmds[i].text, errs[i], outputs[i]))
+		}
+	}
+	if len(failures) > 0 {
+		return nil, errors.Join(failures...)
+	}
+	return outputs, nil
+}
+
+// executeAll executes commands concurrently, with at most maxParallel of them at a time.
+func (s *session) executeAll(commands []command) ([]commandResult, []error) {
+	limit := s.maxParallel
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+
+	results := make([]commandResult, len(commands))
+	errs := make([]error, len(commands))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, c := range commands {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = s.execute(c)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// prefetch concurrently executes the commands of all `$` calls with a literal command found in the
+// expressions, and returns their results.
+func (s *session) prefetch(expressions []string) (prefetchedResults, error) {
+	seen := make(map[string]bool)
+	var commands []command
+	for _, ex := range expressions {
+		tree, err := parser.Parse(ex)
+		if err != nil {
+			return nil, fmt.Errorf("parsing expression %q: %w", ex, err)
+		}
+		finder := &commandFinder{builtinOf: s.builtinOf}
+		ast.Walk(&tree.Node, finder)
+		for _, found := range finder.commands {
+			if !seen[found.text] {
+				seen[found.text] = true
+				commands = append(commands, command{text: found.text, fn: found.fn, expression: ex})
+			}
+		}
+	}
+
+	results, errs := s.executeAll(commands)
+	prefetched := make(prefetchedResults, len(commands))
+	for i, c := range commands {
+		prefetched[commandKey(c.text, c.input)] = prefetchResult{result: results[i], err: errs[i]}
+	}
+	return prefetched, nil
+}
+
+// commandFinder collects the commands of `$` calls (or of its parsing variants) taking a single string literal.
+// builtinOf returns the built-in function of a name in the data.
+type commandFinder struct {
+	builtinOf func(name string) string
+	commands  []commandFinding
+}
+
+type commandFinding struct {
+	text string
+	fn   string
+}
+
+func (f *commandFinder) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok || len(call.Arguments) != 1 {
+		return
+	}
+	ident, ok := call.Callee.(*ast.IdentifierNode)
+	if !ok {
+		return
+	}
+	fn := f.builtinOf(ident.Value)
+	if !isCommandFunction(fn) {
+		return
+	}
+	if str, ok := call.Arguments[0].(*ast.StringNode); ok {
+		f.commands = append(f.commands, commandFinding{text: str.Value, fn: fn})
+	}
+}
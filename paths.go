@@ -0,0 +1,366 @@
+package expression
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr"
+)
+
+// pathFlavor implements lexical path operations for POSIX or Windows paths, regardless of the host, so that
+// paths can be computed for other systems. Windows paths accept both separators, and are compared without
+// case.
+type pathFlavor struct {
+	windows bool
+}
+
+func hostPathFlavor() pathFlavor {
+	return pathFlavor{windows: runtime.GOOS == "windows"}
+}
+
+func (f pathFlavor) separator() string {
+	if f.windows {
+		return `\`
+	}
+	return "/"
+}
+
+func (f pathFlavor) isSeparator(c byte) bool {
+	return c == '/' || (f.windows && c == '\\')
+}
+
+func (f pathFlavor) equal(a, b string) bool {
+	if f.windows {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// volumeLen returns the length of the volume name of a Windows path: a drive such as `C:`, or a UNC share
+// such as `\\host\share`.
+func (f pathFlavor) volumeLen(p string) int {
+	if !f.windows {
+		return 0
+	}
+	if len(p) >= 2 && p[1] == ':' && ('a' <= p[0] && p[0] <= 'z' || 'A' <= p[0] && p[0] <= 'Z') {
+		return 2
+	}
+	if len(p) < 5 || !f.isSeparator(p[0]) || !f.isSeparator(p[1]) || f.isSeparator(p[2]) || p[2] == '.' {
+		return 0
+	}
+	host := 3
+	for host < len(p) && !f.isSeparator(p[host]) {
+		host++
+	}
+	share := host + 1
+	for share < len(p) && !f.isSeparator(p[share]) {
+		share++
+	}
+	if share == host+1 || host == len(p) {
+		return 0
+	}
+	return share
+}
+
+func (f pathFlavor) clean(p string) string {
+	volume := p[:f.volumeLen(p)]
+	rest := p[len(volume):]
+	if rest == "" && volume != "" {
+		if len(volume) > 2 {
+			return f.toSeparator(volume) + f.separator()
+		}
+		return volume + "."
+	}
+	return f.toSeparator(volume) + f.toSeparator(path.Clean(f.fromSeparator(rest)))
+}
+
+// fromSeparator replaces the separators of the flavor with slashes, and toSeparator does the reverse.
+func (f pathFlavor) fromSeparator(p string) string {
+	if f.windows {
+		return strings.ReplaceAll(p, `\`, "/")
+	}
+	return p
+}
+
+func (f pathFlavor) toSeparator(p string) string {
+	if f.windows {
+		return strings.ReplaceAll(p, "/", `\`)
+	}
+	return p
+}
+
+func (f pathFlavor) isAbs(p string) bool {
+	n := f.volumeLen(p)
+	switch {
+	case !f.windows:
+		return strings.HasPrefix(p, "/")
+	case n > 2:
+		return true
+	default:
+		return n == 2 && len(p) > 2 && f.isSeparator(p[2])
+	}
+}
+
+func (f pathFlavor) join(elems []string) string {
+	var b strings.Builder
+	for _, elem := range elems {
+		if elem == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			joined := b.String()
+			last := joined[len(joined)-1]
+			// A drive without separator is relative to the current directory of the drive.
+			if !f.isSeparator(last) && !(f.windows && len(joined) == 2 && f.volumeLen(joined) == 2) {
+				b.WriteString(f.separator())
+			}
+		}
+		b.WriteString(elem)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return f.clean(b.String())
+}
+
+// base returns the last element of a path like filepath.Base: `.` for an empty path, and the separator for
+// a root.
+func (f pathFlavor) base(p string) string {
+	if p == "" {
+		return "."
+	}
+	p = p[f.volumeLen(p):]
+	for len(p) > 0 && f.isSeparator(p[len(p)-1]) {
+		p = p[:len(p)-1]
+	}
+	i := len(p) - 1
+	for i >= 0 && !f.isSeparator(p[i]) {
+		i--
+	}
+	if p = p[i+1:]; p == "" {
+		return f.separator()
+	}
+	return p
+}
+
+func (f pathFlavor) ext(p string) string {
+	for i := len(p) - 1; i >= 0 && !f.isSeparator(p[i]); i-- {
+		if p[i] == '.' {
+			return p[i:]
+		}
+	}
+	return ""
+}
+
+// names returns the names of a path without its volume and root, ignoring empty and `.` names.
+func (f pathFlavor) names(p string) []string {
+	var names []string
+	for _, name := range strings.Split(f.fromSeparator(p[f.volumeLen(p):]), "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// split returns the elements of a cleaned path, the first one holding its volume and root, if any.
+func (f pathFlavor) split(p string) []string {
+	p = f.clean(p)
+	volume := p[:f.volumeLen(p)]
+	rest := p[len(volume):]
+	var elems []string
+	switch {
+	case rest != "" && f.isSeparator(rest[0]):
+		elems = append(elems, volume+f.separator())
+	case volume != "":
+		elems = append(elems, volume)
+	}
+	if rest == "." {
+		return append(elems, ".")
+	}
+	return append(elems, f.names(rest)...)
+}
+
+// rel returns a path to target relative to base, like filepath.Rel.
+func (f pathFlavor) rel(base, target string) (string, error) {
+	base, target = f.clean(base), f.clean(target)
+	if f.equal(base, target) {
+		return ".", nil
+	}
+	baseVolume, targetVolume := base[:f.volumeLen(base)], target[:f.volumeLen(target)]
+	if f.isAbs(base) != f.isAbs(target) || !f.equal(baseVolume, targetVolume) {
+		return "", fmt.Errorf("cannot make %s relative to %s", target, base)
+	}
+	baseNames, targetNames := f.names(base), f.names(target)
+	common := 0
+	for common < len(baseNames) && common < len(targetNames) && f.equal(baseNames[common], targetNames[common]) {
+		common++
+	}
+	if common < len(baseNames) && baseNames[common] == ".." {
+		return "", fmt.Errorf("cannot make %s relative to %s", target, base)
+	}
+	var names []string
+	for range baseNames[common:] {
+		names = append(names, "..")
+	}
+	names = append(names, targetNames[common:]...)
+	if len(names) == 0 {
+		return ".", nil
+	}
+	return strings.Join(names, f.separator()), nil
+}
+
+// match reports whether a path matches a pattern, where `**` matches any number of directories.
+func (f pathFlavor) match(pattern, p string) (bool, error) {
+	if f.windows {
+		pattern, p = strings.ToLower(pattern), strings.ToLower(p)
+	}
+	patterns := strings.Split(f.fromSeparator(pattern), "/")
+	for _, segment := range patterns {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return globMatch(patterns, strings.Split(f.fromSeparator(p), "/"), false, true), nil
+}
+
+// pathOperations returns the functions manipulating paths. They accept a map of options as last argument,
+// whose `flavor` selects POSIX or Windows paths instead of those of the host.
+func pathOperations() []expr.Option {
+	return []expr.Option{
+		pathOperation("joinPath", 0, -1, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.join(args), nil
+		}),
+		pathOperation("absPath", 1, 1, []string{"base"}, func(
+			args []string, opts options, f pathFlavor,
+		) (interface{}, error) {
+			p := args[0]
+			if f.isAbs(p) {
+				return f.clean(p), nil
+			}
+			base, ok := opts["base"].(string)
+			switch {
+			case !ok && opts["base"] != nil:
+				return nil, fmt.Errorf("absPath() option \"base\" must be a string, got %T", opts["base"])
+			case !ok && f != hostPathFlavor():
+				return nil, fmt.Errorf("absPath() requires a base to resolve %s, which is not a path of this system", p)
+			case !ok:
+				wd, err := os.Getwd()
+				if err != nil {
+					return nil, err
+				}
+				base = wd
+			}
+			if f.windows && p != "" && f.isSeparator(p[0]) {
+				// Paths rooted without a drive are on the drive of the base.
+				return f.clean(base[:f.volumeLen(base)] + p), nil
+			}
+			return f.join([]string{base, p}), nil
+		}),
+		pathOperation("relPath", 2, 2, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.rel(args[0], args[1])
+		}),
+		pathOperation("ext", 1, 1, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.ext(args[0]), nil
+		}),
+		pathOperation("stem", 1, 1, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			base := f.base(args[0])
+			if base == "." || base == ".." {
+				return base, nil
+			}
+			return strings.TrimSuffix(base, f.ext(base)), nil
+		}),
+		pathOperation("cleanPath", 1, 1, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.clean(args[0]), nil
+		}),
+		pathOperation("splitPath", 1, 1, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.split(args[0]), nil
+		}),
+		pathOperation("isAbs", 1, 1, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.isAbs(args[0]), nil
+		}),
+		pathOperation("expandHome", 1, 1, []string{"home"}, func(
+			args []string, opts options, f pathFlavor,
+		) (interface{}, error) {
+			p := args[0]
+			if p != "~" && !(len(p) > 1 && p[0] == '~' && f.isSeparator(p[1])) {
+				return p, nil
+			}
+			home, ok := opts["home"].(string)
+			if !ok {
+				if opts["home"] != nil {
+					return nil, fmt.Errorf("expandHome() option \"home\" must be a string, got %T", opts["home"])
+				}
+				var err error
+				if home, err = os.UserHomeDir(); err != nil {
+					return nil, err
+				}
+			}
+			return f.join([]string{home, p[1:]}), nil
+		}),
+		pathOperation("matchPath", 2, 2, nil, func(args []string, _ options, f pathFlavor) (interface{}, error) {
+			return f.match(args[0], args[1])
+		}),
+	}
+}
+
+// pathOperation defines a function taking between minArgs and maxArgs strings (any number if maxArgs is
+// negative), and an optional map of options with the `flavor` and the known options.
+func pathOperation(
+	name string, minArgs, maxArgs int, known []string,
+	fn func(args []string, opts options, f pathFlavor) (interface{}, error),
+) expr.Option {
+	return expr.Function(name, func(params ...interface{}) (interface{}, error) {
+		var opts options
+		if len(params) > 0 {
+			if last, ok := params[len(params)-1].(map[string]interface{}); ok {
+				opts = last
+				params = params[:len(params)-1]
+			}
+		}
+		if len(params) < minArgs || (maxArgs >= 0 && len(params) > maxArgs) {
+			switch {
+			case maxArgs < 0:
+				return nil, fmt.Errorf("%s() takes at least %d arguments", name, minArgs)
+			case minArgs == maxArgs:
+				return nil, fmt.Errorf("%s() takes exactly %d argument%s", name, minArgs, plural(minArgs))
+			default:
+				return nil, fmt.Errorf("%s() takes %d to %d arguments", name, minArgs, maxArgs)
+			}
+		}
+		args := make([]string, len(params))
+		for i, param := range params {
+			arg, ok := param.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s() requires string arguments, got %T", name, param)
+			}
+			args[i] = arg
+		}
+
+		f := hostPathFlavor()
+		for key, value := range opts {
+			switch {
+			case key == "flavor" && value == "posix":
+				f = pathFlavor{}
+			case key == "flavor" && value == "windows":
+				f = pathFlavor{windows: true}
+			case key == "flavor":
+				return nil, fmt.Errorf("%s() option \"flavor\" must be \"posix\" or \"windows\", got %v", name, value)
+			case !slices.Contains(known, key):
+				return nil, fmt.Errorf("%s() has no option %q", name, key)
+			}
+		}
+		return fn(args, opts, f)
+	})
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
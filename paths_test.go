@@ -0,0 +1,123 @@
+package expression_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestPathFunctions(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get the working directory: %v", err)
+	}
+
+	posix := `{flavor: "posix"}`
+	windows := `{flavor: "windows"}`
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"joinPath", `joinPath("a", "b/../c", "d.txt")`, filepath.Join("a", "c", "d.txt")},
+		{"joinPath posix", `joinPath("/srv", "app", "", "bin", ` + posix + `)`, "/srv/app/bin"},
+		{"joinPath windows", `joinPath("C:\\app", "bin/tool.exe", ` + windows + `)`, `C:\app\bin\tool.exe`},
+		{"joinPath windows drive", `joinPath("C:", "app", ` + windows + `)`, `C:app`},
+		{"absPath", `absPath("dir/file")`, filepath.Join(wd, "dir", "file")},
+		{"absPath base", `absPath("../etc", {flavor: "posix", base: "/srv/app"})`, "/srv/etc"},
+		{"absPath windows", `absPath("bin", {flavor: "windows", base: "D:\\app"})`, `D:\app\bin`},
+		{"absPath windows rooted", `absPath("\\tools", {flavor: "windows", base: "D:\\app"})`, `D:\tools`},
+		{"absPath absolute", `absPath("C:/app/./bin", ` + windows + `)`, `C:\app\bin`},
+		{"relPath", `relPath("/srv/app", "/srv/data/db", ` + posix + `)`, "../data/db"},
+		{"relPath same", `relPath("a/b", "a/b/", ` + posix + `)`, "."},
+		{"relPath windows", `relPath("C:\\Users\\Me", "c:\\users\\me\\Documents", ` + windows + `)`, "Documents"},
+		{"ext", `ext("archive.tar.gz")`, ".gz"},
+		{"ext none", `ext("dir.d/Makefile", ` + posix + `)`, ""},
+		{"ext windows", `ext("dir.d\\Makefile", ` + windows + `)`, ""},
+		{"ext posix backslash", `ext("dir.d\\Makefile", ` + posix + `)`, ".d\\Makefile"},
+		{"stem", `stem("/srv/app/config.yaml", ` + posix + `)`, "config"},
+		{"stem windows", `stem("C:\\app\\tool.exe", ` + windows + `)`, "tool"},
+		{"stem dotfile", `stem(".bashrc", ` + posix + `)`, ""},
+		{"stem empty", `stem("", ` + posix + `)`, "."},
+		{"stem windows empty", `stem("", ` + windows + `)`, "."},
+		{"stem parent", `stem("a/..", ` + posix + `)`, ".."},
+		{"ext empty", `ext("")`, ""},
+		{"cleanPath", `cleanPath("a//b/./c/..", ` + posix + `)`, "a/b"},
+		{"cleanPath windows", `cleanPath("C:/a//b/../c", ` + windows + `)`, `C:\a\c`},
+		{"cleanPath windows UNC", `cleanPath("//host/share/a/..", ` + windows + `)`, `\\host\share\`},
+		{"splitPath", `splitPath("/srv/app/bin", ` + posix + `)`, []string{"/", "srv", "app", "bin"}},
+		{"splitPath relative", `splitPath("app/./bin/", ` + posix + `)`, []string{"app", "bin"}},
+		{"splitPath windows", `splitPath("C:\\app\\bin", ` + windows + `)`, []string{`C:\`, "app", "bin"}},
+		{"splitPath windows UNC", `splitPath("\\\\host\\share\\app", ` + windows + `)`,
+			[]string{`\\host\share\`, "app"}},
+		{"isAbs", `isAbs("/srv", ` + posix + `)`, true},
+		{"isAbs relative", `isAbs("srv", ` + posix + `)`, false},
+		{"isAbs windows", `isAbs("C:\\srv", ` + windows + `)`, true},
+		{"isAbs windows rooted", `isAbs("\\srv", ` + windows + `)`, false},
+		{"isAbs windows posix path", `isAbs("/srv", ` + windows + `)`, false},
+		{"expandHome", `expandHome("~/.config")`, filepath.Join(home, ".config")},
+		{"expandHome alone", `expandHome("~")`, filepath.Clean(home)},
+		{"expandHome given", `expandHome("~\\AppData", {flavor: "windows", home: "C:\\Users\\me"})`,
+			`C:\Users\me\AppData`},
+		{"expandHome other user", `expandHome("~other/x")`, "~other/x"},
+		{"matchPath", `matchPath("src/**/*.go", "src/pkg/sub/main.go", ` + posix + `)`, true},
+		{"matchPath dotfiles", `matchPath("**/*", ".github/workflows/ci.yml", ` + posix + `)`, true},
+		{"matchPath mismatch", `matchPath("src/*.go", "src/pkg/main.go", ` + posix + `)`, false},
+		{"matchPath windows", `matchPath("SRC\\*.GO", "src/main.go", ` + windows + `)`, true},
+		{"matchPath posix case", `matchPath("SRC/*.GO", "src/main.go", ` + posix + `)`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, nil)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestPathFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"unknown flavor", `cleanPath("a", {flavor: "vms"})`, `option "flavor" must be "posix" or "windows"`},
+		{"unknown option", `cleanPath("a", {base: "/"})`, `cleanPath() has no option "base"`},
+		{"missing argument", `relPath("a")`, "relPath() takes exactly 2 arguments"},
+		{"wrong type", `ext(1)`, "ext() requires string arguments"},
+		{"relative to absolute", `relPath("/a", "b", {flavor: "posix"})`, "cannot make b relative to /a"},
+		{"other drive", `relPath("C:\\a", "D:\\a", {flavor: "windows"})`, `cannot make D:\a relative to C:\a`},
+		{"missing base", `absPath("a", {flavor: "` + otherFlavor() + `"})`, "absPath() requires a base"},
+		{"invalid pattern", `matchPath("[", "a")`, `invalid pattern "["`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.Evaluate(test.expr, nil)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+// otherFlavor returns the path flavor of the systems other than the host.
+func otherFlavor() string {
+	if filepath.Separator == '\\' {
+		return "posix"
+	}
+	return "windows"
+}
@@ -0,0 +1,73 @@
+package expression
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/expr-lang/expr"
+)
+
+// permissionFunctions returns the functions inspecting the permissions, the ownership and the links of files.
+func permissionFunctions(s *session, ex string) []expr.Option {
+	return []expr.Option{
+		fileFunction(s, ex, "isExecutable", func(path string) (bool, error) {
+			return fileAccess(path, accessExecute), nil
+		}),
+		fileFunction(s, ex, "isReadable", func(path string) (bool, error) {
+			return fileAccess(path, accessRead), nil
+		}),
+		fileFunction(s, ex, "isWritable", func(path string) (bool, error) {
+			return fileAccess(path, accessWrite), nil
+		}),
+		fileFunction(s, ex, "isSymlink", func(path string) (bool, error) {
+			info, err := os.Lstat(path)
+			return err == nil && info.Mode()&fs.ModeSymlink != 0, nil
+		}),
+		fileFunction(s, ex, "readlink", os.Readlink),
+		fileFunction(s, ex, "fileMode", func(path string) (string, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			return formatFileMode(info.Mode()), nil
+		}),
+		fileFunction(s, ex, "fileOwner", fileOwner),
+		fileFunction(s, ex, "fileGroup", fileGroup),
+	}
+}
+
+// statFunction defines a function testing a file, which takes a path and an optional map of options. With
+// `followSymlinks: false`, symbolic links are tested themselves instead of their targets. Missing files fail
+// the test.
+func statFunction(s *session, ex, name string, test func(info fs.FileInfo) bool) expr.Option {
+	return expr.Function(name, func(params ...interface{}) (interface{}, error) {
+		path, opts, err := pathAndOptions(name, params, []string{"followSymlinks"})
+		if err != nil {
+			return nil, err
+		}
+		follow := true
+		if value, ok := opts["followSymlinks"]; ok {
+			if follow, ok = value.(bool); !ok {
+				return nil, fmt.Errorf("%s() option \"followSymlinks\" must be a bool, got %T", name, value)
+			}
+		}
+		return fileCall(s, ex, name, path, opts, func() (bool, error) {
+			stat := os.Stat
+			if !follow {
+				stat = os.Lstat
+			}
+			info, err := stat(path)
+			return err == nil && test(info), nil
+		})
+	})
+}
+
+// access is the kind of access checked by fileAccess.
+type access int
+
+const (
+	accessRead access = iota
+	accessWrite
+	accessExecute
+)
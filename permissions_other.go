@@ -0,0 +1,54 @@
+//go:build !unix
+
+package expression
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// fileAccess reports whether a file allows an access. Files are writable unless read-only, and executable if
+// their extension is listed in PATHEXT.
+func fileAccess(path string, a access) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	switch a {
+	case accessWrite:
+		return info.Mode().Perm()&0200 != 0
+	case accessExecute:
+		if info.IsDir() {
+			return false
+		}
+		exts := os.Getenv("PATHEXT")
+		if exts == "" {
+			exts = ".com;.exe;.bat;.cmd"
+		}
+		ext := filepath.Ext(path)
+		for _, e := range filepath.SplitList(exts) {
+			if ext != "" && strings.EqualFold(e, ext) {
+				return true
+			}
+		}
+		return false
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		_ = f.Close()
+		return true
+	}
+}
+
+func fileOwner(string) (string, error) {
+	return "", fmt.Errorf("file owners are not supported on %s", runtime.GOOS)
+}
+
+func fileGroup(string) (string, error) {
+	return "", fmt.Errorf("file groups are not supported on %s", runtime.GOOS)
+}
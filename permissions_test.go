@@ -0,0 +1,109 @@
+package expression_test
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestPermissionFunctions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions and symbolic links differ on windows")
+	}
+	dir := newFileTree(t, "script.sh", "config.txt", "secret.txt")
+	for file, mode := range map[string]os.FileMode{"script.sh": 0755, "config.txt": 0644, "secret.txt": 0400} {
+		if err := os.Chmod(filepath.Join(dir, file), mode); err != nil {
+			t.Fatalf("failed to set the mode of %s: %v", file, err)
+		}
+	}
+	if err := os.Symlink("config.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+	if err := os.Symlink("missing.txt", filepath.Join(dir, "broken")); err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+	owner, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+	group := owner.Gid
+	if g, err := user.LookupGroupId(owner.Gid); err == nil {
+		group = g.Name
+	}
+	data := map[string]interface{}{"dir": dir}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"isExecutable", `isExecutable(dir + "/script.sh")`, true},
+		{"isExecutable not executable", `isExecutable(dir + "/config.txt")`, false},
+		{"isExecutable directory", `isExecutable(dir)`, false},
+		{"isExecutable missing", `isExecutable(dir + "/missing")`, false},
+		{"isReadable", `isReadable(dir + "/config.txt")`, true},
+		{"isReadable missing", `isReadable(dir + "/missing")`, false},
+		{"isWritable", `isWritable(dir + "/config.txt")`, true},
+		{"isWritable missing", `isWritable(dir + "/missing")`, false},
+		{"isSymlink", `isSymlink(dir + "/link")`, true},
+		{"isSymlink broken", `isSymlink(dir + "/broken")`, true},
+		{"isSymlink file", `isSymlink(dir + "/config.txt")`, false},
+		{"readlink", `readlink(dir + "/link")`, "config.txt"},
+		{"fileMode", `fileMode(dir + "/script.sh")`, "0755"},
+		{"fileMode through link", `fileMode(dir + "/link")`, "0644"},
+		{"fileOwner", `fileOwner(dir + "/config.txt")`, owner.Username},
+		{"fileGroup", `fileGroup(dir + "/config.txt")`, group},
+		{"fileExists broken link", `fileExists(dir + "/broken")`, false},
+		{"fileExists broken link without following", `fileExists(dir + "/broken", {followSymlinks: false})`, true},
+		{"isFile link", `isFile(dir + "/link")`, true},
+		{"isFile link without following", `isFile(dir + "/link", {followSymlinks: false})`, false},
+		{"isFile without following", `isFile(dir + "/config.txt", {followSymlinks: false})`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+
+	if os.Geteuid() != 0 {
+		// The superuser can read and write any file.
+		if writable, err := expression.Evaluate(`isWritable(dir + "/secret.txt")`, data); err != nil || writable != false {
+			t.Errorf("expected a read-only file not to be writable, got %v (%v)", writable, err)
+		}
+	}
+}
+
+func TestPermissionFunctionErrors(t *testing.T) {
+	dir := newFileTree(t, "file.txt")
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"readlink not a link", `readlink(dir + "/file.txt")`, "readlink"},
+		{"fileMode missing", `fileMode(dir + "/missing")`, "no such file"},
+		{"invalid option", `fileExists(dir, {followSymlinks: "no"})`, `option "followSymlinks" must be a bool`},
+		{"unknown option", `isFile(dir, {follow: false})`, `isFile() has no option "follow"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.Evaluate(test.expr, map[string]interface{}{"dir": dir})
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
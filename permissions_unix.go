@@ -0,0 +1,68 @@
+//go:build unix
+
+package expression
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileAccess reports whether the current user has an access to a file. Directories are not executable.
+func fileAccess(path string, a access) bool {
+	var mode uint32
+	switch a {
+	case accessRead:
+		mode = unix.R_OK
+	case accessWrite:
+		mode = unix.W_OK
+	case accessExecute:
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return false
+		}
+		mode = unix.X_OK
+	}
+	return unix.Access(path, mode) == nil
+}
+
+// fileOwner returns the name of the user owning a file, or its uid if it has no name.
+func fileOwner(path string) (string, error) {
+	stat, err := fileStat(path)
+	if err != nil {
+		return "", err
+	}
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username, nil
+	}
+	return uid, nil
+}
+
+// fileGroup returns the name of the group owning a file, or its gid if it has no name.
+func fileGroup(path string) (string, error) {
+	stat, err := fileStat(path)
+	if err != nil {
+		return "", err
+	}
+	gid := strconv.FormatUint(uint64(stat.Gid), 10)
+	if g, err := user.LookupGroupId(gid); err == nil {
+		return g.Name, nil
+	}
+	return gid, nil
+}
+
+func fileStat(path string) (*syscall.Stat_t, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, fmt.Errorf("no ownership information for %s", path)
+	}
+	return stat, nil
+}
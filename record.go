@@ -0,0 +1,276 @@
+package expression
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Bundle holds the interactions of expressions with the system captured by a Recorder.
+// It can be saved to a file and replayed with WithReplay to evaluate expressions hermetically.
+type Bundle struct {
+	Env      map[string]string `json:"env"`
+	Commands []CommandRecord   `json:"commands"`
+	Files    []FileRecord      `json:"files"`
+}
+
+// CommandRecord is a command executed by the `$` or `run` functions.
+type CommandRecord struct {
+	Command  string  `json:"command"`
+	Input    *string `json:"input,omitempty"`
+	Stdout   string  `json:"stdout"`
+	Stderr   string  `json:"stderr"`
+	ExitCode int     `json:"exitCode"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// FileRecord is a call to a file helper function.
+type FileRecord struct {
+	Function string          `json:"function"`
+	Path     string          `json:"path"`
+	Result   json.RawMessage `json:"result"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// LoadBundle reads a bundle saved by Recorder.Save.
+func LoadBundle(file string) (*Bundle, error) {
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle file %s: %w", file, err)
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("parsing bundle file %s: %w", file, err)
+	}
+	return &bundle, nil
+}
+
+// Recorder captures every command, file helper call and the environment of the data it is attached
+// to with WithRecorder. It is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	bundle Bundle
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// WithRecorder records the interactions of the built-in functions into the recorder. Secrets are redacted
+// from the recorded interactions, and replayed calls are looked up with their secrets redacted too.
+func WithRecorder(r *Recorder) Option {
+	return func(s *session) {
+		s.recorder = r
+	}
+}
+
+// WithReplay serves the built-in functions from a recorded bundle instead of the system. The `env`
+// variable is replaced by the recorded environment, and calls that were not recorded fail.
+func WithReplay(b *Bundle) Option {
+	return func(s *session) {
+		s.replay = newReplayer(b)
+	}
+}
+
+// Bundle returns a copy of the interactions recorded so far.
+func (r *Recorder) Bundle() *Bundle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Bundle{
+		Env:      maps.Clone(r.bundle.Env),
+		Commands: append([]CommandRecord(nil), r.bundle.Commands...),
+		Files:    append([]FileRecord(nil), r.bundle.Files...),
+	}
+}
+
+// Save writes the recorded bundle to a JSON file.
+func (r *Recorder) Save(file string) error {
+	data, err := json.MarshalIndent(r.Bundle(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding bundle: %w", err)
+	}
+	if err := os.WriteFile(filepath.Clean(file), data, 0600); err != nil {
+		return fmt.Errorf("writing bundle file %s: %w", file, err)
+	}
+	return nil
+}
+
+// recordEnv records environment variables, with secrets redacted as bundles are meant to be shared, for
+// instance in bug reports. Variables matching the patterns of WithSecretEnv are redacted as a whole, even
+// when they are looked up in the host environment.
+func (s *session) recordEnv(env map[string]string) {
+	redactedEnv := make(map[string]string, len(env))
+	for k, v := range env {
+		if v != "" && envAllowed(k, s.secretEnv) {
+			v = redacted
+		}
+		redactedEnv[k] = s.redact(v)
+	}
+	s.recorder.recordEnv(redactedEnv)
+}
+
+// recordCommand records a command, with secrets redacted from the command and its streams.
+func (s *session) recordCommand(c command, result commandResult, err error) {
+	c = s.redactCommand(c)
+	result.stdout, result.stderr = s.redact(result.stdout), s.redact(result.stderr)
+	s.recorder.recordCommand(c, result, s.newEvaluation().redactError(err))
+}
+
+// recordFile records a call of a file helper, with secrets redacted from its key and its result.
+func (s *session) recordFile(function, key string, result interface{}, err error) {
+	if len(s.secrets) > 0 && err == nil {
+		if encoded, encErr := json.Marshal(result); encErr == nil {
+			result = json.RawMessage(s.redactJSON(string(encoded)))
+		}
+	}
+	s.recorder.recordFile(function, s.redact(key), result, s.newEvaluation().redactError(err))
+}
+
+// redactCommand returns a command with secrets redacted, as it is recorded and looked up when replaying.
+func (s *session) redactCommand(c command) command {
+	c.text = s.redact(c.text)
+	if c.input != nil {
+		input := s.redact(*c.input)
+		c.input = &input
+	}
+	return c
+}
+
+// redactJSON replaces the secrets in JSON text, where they are encoded as JSON strings.
+func (s *session) redactJSON(text string) string {
+	for _, secret := range s.secrets {
+		encoded, err := json.Marshal(secret)
+		if err != nil {
+			continue
+		}
+		text = strings.ReplaceAll(text, string(encoded[1:len(encoded)-1]), redacted)
+	}
+	return text
+}
+
+func (r *Recorder) recordEnv(env map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bundle.Env == nil {
+		r.bundle.Env = make(map[string]string)
+	}
+	maps.Copy(r.bundle.Env, env)
+}
+
+func (r *Recorder) recordCommand(c command, result commandResult, err error) {
+	record := CommandRecord{
+		Command:  c.text,
+		Input:    c.input,
+		Stdout:   result.stdout,
+		Stderr:   result.stderr,
+		ExitCode: result.exitCode,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundle.Commands = append(r.bundle.Commands, record)
+}
+
+func (r *Recorder) recordFile(function, path string, result interface{}, err error) {
+	record := FileRecord{Function: function, Path: path}
+	if err != nil {
+		record.Error = err.Error()
+	} else if encoded, encErr := json.Marshal(result); encErr == nil {
+		record.Result = encoded
+	} else {
+		record.Error = fmt.Sprintf("encoding result: %v", encErr)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundle.Files = append(r.bundle.Files, record)
+}
+
+// replayer serves recorded interactions in the order they were recorded. Once all the records
+// of a call are consumed, the last one is served again.
+type replayer struct {
+	mu       sync.Mutex
+	bundle   *Bundle
+	commands map[string][]CommandRecord
+	files    map[string][]FileRecord
+}
+
+func newReplayer(b *Bundle) *replayer {
+	if b == nil {
+		b = &Bundle{}
+	}
+	r := &replayer{
+		bundle:   b,
+		commands: make(map[string][]CommandRecord),
+		files:    make(map[string][]FileRecord),
+	}
+	for _, record := range b.Commands {
+		key := commandKey(record.Command, record.Input)
+		r.commands[key] = append(r.commands[key], record)
+	}
+	for _, record := range b.Files {
+		key := fileKey(record.Function, record.Path)
+		r.files[key] = append(r.files[key], record)
+	}
+	return r
+}
+
+func (r *replayer) command(c command) (commandResult, error) {
+	r.mu.Lock()
+	records := r.commands[commandKey(c.text, c.input)]
+	if len(records) > 1 {
+		r.commands[commandKey(c.text, c.input)] = records[1:]
+	}
+	r.mu.Unlock()
+
+	if len(records) == 0 {
+		return commandResult{exitCode: -1}, fmt.Errorf("replay: no recorded result for command %q", c.text)
+	}
+	record := records[0]
+	result := commandResult{stdout: record.Stdout, stderr: record.Stderr, exitCode: record.ExitCode}
+	if record.Error != "" {
+		return result, errors.New(record.Error)
+	}
+	return result, nil
+}
+
+func replayFile[T any](r *replayer, function, path string) (T, error) {
+	var result T
+	r.mu.Lock()
+	records := r.files[fileKey(function, path)]
+	if len(records) > 1 {
+		r.files[fileKey(function, path)] = records[1:]
+	}
+	r.mu.Unlock()
+
+	if len(records) == 0 {
+		return result, fmt.Errorf("replay: no recorded result for %s(%q)", function, path)
+	}
+	record := records[0]
+	if record.Error != "" {
+		return result, errors.New(record.Error)
+	}
+	if err := json.Unmarshal(record.Result, &result); err != nil {
+		return result, fmt.Errorf("replay: decoding recorded result for %s(%q): %w", function, path, err)
+	}
+	return result, nil
+}
+
+func commandKey(text string, input *string) string {
+	if input == nil {
+		return text
+	}
+	return text + "\x00" + *input
+}
+
+func fileKey(function, path string) string {
+	return function + "\x00" + path
+}
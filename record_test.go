@@ -0,0 +1,161 @@
+package expression_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test.txt")
+	bundleFile := filepath.Join(tempDir, "bundle.json")
+	if err := os.WriteFile(testFile, []byte("recorded content"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	exprs := []struct {
+		name string
+		expr string
+	}{
+		{"command", `$("echo $GREETING")`},
+		{"command input", `$("cat", {input: "from input"})`},
+		{"failed", `$("echo oops >&2; exit 3")`},
+		{"fileExists", `fileExists("` + testFile + `")`},
+		{"readFile", `readFile("` + testFile + `")`},
+		{"fileSize", `fileSize("` + testFile + `")`},
+		{"env", `env.GREETING`},
+	}
+
+	recorder := expression.NewRecorder()
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"GREETING": "hello"},
+		[]expression.Option{expression.WithRecorder(recorder)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	recorded := make(map[string]string)
+	for _, ex := range exprs {
+		result, err := expression.EvaluateString(ex.expr, data)
+		if err != nil {
+			result = "error: " + err.Error()
+		}
+		recorded[ex.name] = result
+	}
+	if recorded["command"] != "hello" || recorded["readFile"] != "recorded content" {
+		t.Fatalf("unexpected recorded results: %v", recorded)
+	}
+	if !strings.Contains(recorded["failed"], "non-zero status exit status 3") {
+		t.Fatalf("expected failed command error, got %q", recorded["failed"])
+	}
+
+	bundle := recorder.Bundle()
+	if len(bundle.Commands) != 3 || len(bundle.Files) != 3 {
+		t.Fatalf("expected 3 commands and 3 file calls, got %d and %d", len(bundle.Commands), len(bundle.Files))
+	}
+	if bundle.Commands[2].ExitCode != 3 || bundle.Commands[2].Stderr != "oops\n" {
+		t.Errorf("expected exit code and stderr to be recorded, got %+v", bundle.Commands[2])
+	}
+	if err := recorder.Save(bundleFile); err != nil {
+		t.Fatalf("expected no error saving bundle, got %v", err)
+	}
+
+	if err := os.Remove(testFile); err != nil {
+		t.Fatalf("failed to remove test file: %v", err)
+	}
+	loaded, err := expression.LoadBundle(bundleFile)
+	if err != nil {
+		t.Fatalf("expected no error loading bundle, got %v", err)
+	}
+	replayData, err := expression.BuildDataWithOptions(
+		context.Background(), nil, []expression.Option{expression.WithReplay(loaded)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+
+	for _, ex := range exprs {
+		t.Run(ex.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(ex.expr, replayData)
+			if err != nil {
+				result = "error: " + err.Error()
+			}
+			if result != recorded[ex.name] {
+				t.Errorf("expected %q, got %q", recorded[ex.name], result)
+			}
+		})
+	}
+
+	t.Run("unrecorded calls fail", func(t *testing.T) {
+		for _, ex := range []string{`$("echo other")`, `$("cat", {input: "other"})`, `isDir("` + tempDir + `")`} {
+			_, err := expression.Evaluate(ex, replayData)
+			if err == nil || !strings.Contains(err.Error(), "no recorded result") {
+				t.Errorf("expected unrecorded error for %s, got %v", ex, err)
+			}
+		}
+	})
+}
+
+func TestRecordRedactsSecrets(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "token.txt")
+	bundleFile := filepath.Join(tempDir, "bundle.json")
+	if err := os.WriteFile(testFile, []byte("token=hunter2"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	recorder := expression.NewRecorder()
+	vars := []interface{}{"password", expression.NewSecret("hunter2"), "file", testFile}
+	data, err := expression.BuildDataWithOptions(
+		context.Background(),
+		map[string]string{"API_TOKEN": "tok123", "NAME": "app"},
+		[]expression.Option{expression.WithRecorder(recorder), expression.WithSecretEnv("*_TOKEN")},
+		vars...,
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	exprs := []string{`$("echo " + password + " $API_TOKEN")`, `readFile(file)`, `$("cat", {input: password})`}
+	for _, ex := range exprs {
+		if _, err := expression.Evaluate(ex, data); err != nil {
+			t.Fatalf("expected no error evaluating %s, got %v", ex, err)
+		}
+	}
+	if err := recorder.Save(bundleFile); err != nil {
+		t.Fatalf("expected no error saving bundle, got %v", err)
+	}
+
+	saved, err := os.ReadFile(bundleFile)
+	if err != nil {
+		t.Fatalf("failed to read bundle: %v", err)
+	}
+	if strings.Contains(string(saved), "hunter2") || strings.Contains(string(saved), "tok123") {
+		t.Errorf("expected secrets to be redacted from the bundle, got %s", saved)
+	}
+
+	loaded, err := expression.LoadBundle(bundleFile)
+	if err != nil {
+		t.Fatalf("expected no error loading bundle, got %v", err)
+	}
+	replayData, err := expression.BuildDataWithOptions(
+		context.Background(), nil, []expression.Option{expression.WithReplay(loaded)}, vars...,
+	)
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	for _, ex := range exprs {
+		result, err := expression.EvaluateString(ex, replayData)
+		if err != nil {
+			t.Errorf("expected %s to be replayed, got %v", ex, err)
+		} else if strings.Contains(result, "hunter2") || strings.Contains(result, "tok123") {
+			t.Errorf("expected replayed secrets to be redacted, got %q", result)
+		}
+	}
+}
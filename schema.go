@@ -0,0 +1,255 @@
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// VarType is the type of a declared variable.
+type VarType string
+
+const (
+	TypeAny    VarType = ""
+	TypeString VarType = "string"
+	TypeInt    VarType = "int"
+	// TypeFloat accepts any number.
+	TypeFloat VarType = "float"
+	TypeBool  VarType = "bool"
+	TypeList  VarType = "list"
+	TypeMap   VarType = "map"
+)
+
+// Variable declares a variable that expressions expect. Names can be key paths such as `app.name`.
+type Variable struct {
+	Name        string
+	Type        VarType
+	Required    bool
+	Default     interface{}
+	Enum        []interface{}
+	Pattern     string
+	Description string
+}
+
+// Schema declares the variables of the data, so that missing or invalid variables are reported before
+// evaluating expressions instead of failing, or silently misbehaving, halfway.
+type Schema []Variable
+
+// Violation is a variable that does not match its declaration.
+type Violation struct {
+	Name    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Name + " " + v.Message
+}
+
+// SchemaError reports all the variables that do not match a schema.
+type SchemaError struct {
+	Violations []Violation
+}
+
+func (e *SchemaError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return "invalid variables: " + strings.Join(messages, "; ")
+}
+
+// WithSchema validates the variables of the data against a schema, filling the defaults of missing
+// variables. All violations are returned at once as a *SchemaError.
+func WithSchema(schema Schema) Option {
+	return func(s *session) {
+		s.schema = append(s.schema, schema...)
+	}
+}
+
+// NewTemplateWithSchema is like NewTemplate, but validates the data against a schema first, filling the
+// defaults of missing variables.
+func NewTemplateWithSchema(name string, data Data, schema Schema) (*Template, error) {
+	validated, err := schema.Apply(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewTemplate(name, validated), nil
+}
+
+// Apply validates data against the schema and returns a copy of it with the defaults of missing variables
+// filled. Data must be a map with string keys. All violations are returned at once as a *SchemaError.
+func (schema Schema) Apply(data Data) (Data, error) {
+	vars := make(map[string]interface{})
+	if data != nil {
+		v := reflect.ValueOf(data)
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("schema requires map data, got %T", data)
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			vars[iter.Key().String()] = iter.Value().Interface()
+		}
+	}
+	if err := schema.apply(vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// apply validates vars against the schema and fills the defaults of missing variables.
+func (schema Schema) apply(vars map[string]interface{}) error {
+	var violations []Violation
+	for _, variable := range schema {
+		violate := func(message string) {
+			violations = append(violations, Violation{Name: variable.Name, Message: message})
+		}
+		value, ok, err := getKeyPath(vars, variable.Name)
+		if err != nil {
+			violate(err.Error())
+			continue
+		}
+		if !ok || value == nil {
+			if variable.Default == nil {
+				if variable.Required {
+					violate(variable.requiredMessage())
+				}
+				continue
+			}
+			value = variable.Default
+			if err := setKeyPath(vars, variable.Name, value); err != nil {
+				violate(err.Error())
+				continue
+			}
+		}
+		for _, message := range variable.check(value) {
+			violate(message)
+		}
+	}
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+func (variable Variable) requiredMessage() string {
+	if variable.Description != "" {
+		return fmt.Sprintf("is required (%s)", variable.Description)
+	}
+	return "is required"
+}
+
+// check returns the ways a value does not match the declaration of the variable.
+func (variable Variable) check(value interface{}) []string {
+	var messages []string
+	// Secrets are validated as strings, but displayed redacted.
+	display := value
+	if secret, ok := value.(Secret); ok {
+		value = secret.Reveal()
+	}
+	switch variable.Type {
+	case TypeAny, TypeString, TypeInt, TypeFloat, TypeBool, TypeList, TypeMap:
+	default:
+		return append(messages, fmt.Sprintf("has an unknown type %q", variable.Type))
+	}
+	if !variable.Type.matches(value) {
+		messages = append(messages, fmt.Sprintf("must be of type %s, got %s", variable.Type, typeName(value)))
+		return messages
+	}
+	if len(variable.Enum) > 0 && !enumContains(variable.Enum, value) {
+		allowed := make([]string, len(variable.Enum))
+		for i, item := range variable.Enum {
+			allowed[i] = fmt.Sprintf("%v", item)
+		}
+		messages = append(messages, fmt.Sprintf("must be one of %s, got %v", strings.Join(allowed, ", "), display))
+	}
+	if variable.Pattern != "" {
+		pattern, err := regexp.Compile(variable.Pattern)
+		str, isString := value.(string)
+		switch {
+		case err != nil:
+			messages = append(messages, fmt.Sprintf("has an invalid pattern: %v", err))
+		case !isString:
+			messages = append(messages, fmt.Sprintf("must be a string to match pattern %s, got %s",
+				variable.Pattern, typeName(value)))
+		case !pattern.MatchString(str):
+			messages = append(messages, fmt.Sprintf("must match pattern %s, got %q", variable.Pattern, display))
+		}
+	}
+	return messages
+}
+
+func (t VarType) matches(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	switch t {
+	case TypeAny:
+		return true
+	case TypeString:
+		return v.Kind() == reflect.String
+	case TypeInt:
+		return isInt(v)
+	case TypeFloat:
+		return isInt(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+	case TypeBool:
+		return v.Kind() == reflect.Bool
+	case TypeList:
+		return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+	case TypeMap:
+		return v.Kind() == reflect.Map
+	default:
+		return false
+	}
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func typeName(value interface{}) string {
+	v := reflect.ValueOf(value)
+	for _, t := range []VarType{TypeString, TypeInt, TypeFloat, TypeBool, TypeList, TypeMap} {
+		if t.matches(value) {
+			return string(t)
+		}
+	}
+	if !v.IsValid() {
+		return "nil"
+	}
+	return v.Type().String()
+}
+
+// enumContains reports whether value is one of the allowed values, comparing numbers by value regardless
+// of their type.
+func enumContains(allowed []interface{}, value interface{}) bool {
+	for _, item := range allowed {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+		a, aOk := toFloat(item)
+		b, bOk := toFloat(value)
+		if aOk && bOk && a == b {
+			return true
+		}
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch {
+	case v.CanInt():
+		return float64(v.Int()), true
+	case v.CanUint():
+		return float64(v.Uint()), true
+	case v.CanFloat():
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,132 @@
+package expression_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+var testSchema = expression.Schema{
+	{Name: "app.name", Type: expression.TypeString, Required: true, Pattern: `^[a-z][a-z0-9-]*$`,
+		Description: "the application name"},
+	{Name: "replicas", Type: expression.TypeInt, Default: 1},
+	{Name: "environment", Type: expression.TypeString, Default: "dev", Enum: []interface{}{"dev", "staging", "prod"}},
+	{Name: "ratio", Type: expression.TypeFloat},
+	{Name: "tags", Type: expression.TypeList, Default: []interface{}{}},
+}
+
+func TestBuildDataWithSchema(t *testing.T) {
+	data, err := expression.BuildDataWithOptions(context.Background(), nil,
+		[]expression.Option{expression.WithSchema(testSchema)},
+		"app.name", "web", "environment", "prod", "ratio", 2,
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"given value", `app.name`, "web"},
+		{"default", `replicas`, 1},
+		{"given enum value", `environment`, "prod"},
+		{"int as float", `ratio`, 2},
+		{"list default", `len(tags)`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	_, err := expression.NewData(context.Background(),
+		expression.WithSchema(testSchema),
+		expression.WithVars(map[string]interface{}{
+			"replicas":    "two",
+			"environment": "qa",
+			"ratio":       true,
+		}),
+	)
+	var schemaErr *expression.SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected a schema error, got %v", err)
+	}
+
+	expected := []expression.Violation{
+		{Name: "app.name", Message: "is required (the application name)"},
+		{Name: "replicas", Message: "must be of type int, got string"},
+		{Name: "environment", Message: "must be one of dev, staging, prod, got qa"},
+		{Name: "ratio", Message: "must be of type float, got bool"},
+	}
+	if !reflect.DeepEqual(schemaErr.Violations, expected) {
+		t.Errorf("expected violations %v, got %v", expected, schemaErr.Violations)
+	}
+	if !strings.HasPrefix(err.Error(), "invalid variables: app.name is required") {
+		t.Errorf("expected all violations in the error message, got %q", err.Error())
+	}
+}
+
+func TestSchemaPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   expression.Schema
+		value    interface{}
+		expected string
+	}{
+		{"mismatch", expression.Schema{{Name: "name", Pattern: `^[a-z]+$`}}, "Web",
+			"name must match pattern ^[a-z]+$, got \"Web\""},
+		{"not a string", expression.Schema{{Name: "name", Pattern: `^[a-z]+$`}}, 3,
+			"name must be a string to match pattern ^[a-z]+$, got int"},
+		{"invalid pattern", expression.Schema{{Name: "name", Pattern: `(`}}, "web", "name has an invalid pattern"},
+		{"unknown type", expression.Schema{{Name: "name", Type: "text"}}, "web", `name has an unknown type "text"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.schema.Apply(map[string]interface{}{"name": test.value})
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestNewTemplateWithSchema(t *testing.T) {
+	data := map[string]interface{}{"app": map[string]interface{}{"name": "web"}}
+	tmpl, err := expression.NewTemplateWithSchema("test", data, testSchema)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := tmpl.Parse(`{{app.name}} x{{replicas}} in {{environment}}`); err != nil {
+		t.Fatalf("expected no error parsing, got %v", err)
+	}
+	result, err := tmpl.ExecuteToString()
+	if err != nil {
+		t.Fatalf("expected no error executing, got %v", err)
+	}
+	if result != "web x1 in dev" {
+		t.Errorf("expected %q, got %q", "web x1 in dev", result)
+	}
+	if _, ok := data["replicas"]; ok {
+		t.Error("expected the caller's data to be unchanged")
+	}
+
+	if _, err := expression.NewTemplateWithSchema("test", map[string]interface{}{}, testSchema); err == nil {
+		t.Error("expected an error for a missing required variable")
+	}
+}
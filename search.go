@@ -0,0 +1,153 @@
+package expression
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/expr-lang/expr"
+)
+
+// GrepMatch is a line matched by the `grepFile` function.
+type GrepMatch struct {
+	// Line is the number of the line, starting at 1.
+	Line int    `expr:"line" json:"line"`
+	Text string `expr:"text" json:"text"`
+	// Groups holds the capture groups of the first match in the line.
+	Groups []string `expr:"groups" json:"groups"`
+}
+
+// searchFunctions returns the functions searching the content of files. They read files as streams, so that
+// large files are not loaded in memory.
+func searchFunctions(s *session, ex string) []expr.Option {
+	return []expr.Option{
+		expr.Function("fileContains", func(params ...interface{}) (interface{}, error) {
+			path, substr, err := twoStringArgs("fileContains", params)
+			if err != nil {
+				return nil, err
+			}
+			return fileCall(s, ex, "fileContains", path, options{"substr": substr}, func() (bool, error) {
+				return fileContains(path, substr)
+			})
+		}),
+		expr.Function("grepFile", func(params ...interface{}) (interface{}, error) {
+			path, pattern, err := twoStringArgs("grepFile", params)
+			if err != nil {
+				return nil, err
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("grepFile() invalid pattern: %w", err)
+			}
+			return fileCall(s, ex, "grepFile", path, options{"pattern": pattern}, func() ([]GrepMatch, error) {
+				return grepFile(path, re)
+			})
+		}),
+		fileFunction(s, ex, "lineCount", lineCount),
+	}
+}
+
+// twoStringArgs returns the two string arguments of a function.
+func twoStringArgs(name string, params []interface{}) (string, string, error) {
+	if len(params) != 2 {
+		return "", "", fmt.Errorf("%s() takes exactly 2 arguments", name)
+	}
+	first, ok := params[0].(string)
+	second, ok2 := params[1].(string)
+	if !ok || !ok2 {
+		return "", "", fmt.Errorf("%s() requires string arguments", name)
+	}
+	return first, second, nil
+}
+
+// fileContains reports whether a file contains a string, which may span several lines.
+func fileContains(path, substr string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if substr == "" {
+		return true, nil
+	}
+
+	// Keep the end of the previous chunk, in case the string starts there.
+	overlap := len(substr) - 1
+	buf := make([]byte, max(64*1024, 2*len(substr)))
+	kept := 0
+	for {
+		n, err := io.ReadFull(f, buf[kept:])
+		if bytes.Contains(buf[:kept+n], []byte(substr)) {
+			return true, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		kept = copy(buf, buf[kept+n-overlap:kept+n])
+	}
+}
+
+// grepFile returns the lines of a file matching a regular expression.
+func grepFile(path string, re *regexp.Regexp) ([]GrepMatch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	matches := []GrepMatch{}
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		text, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if text == "" && err == io.EOF {
+			return matches, nil
+		}
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		if submatches := re.FindStringSubmatch(text); submatches != nil {
+			matches = append(matches, GrepMatch{Line: line, Text: text, Groups: submatches[1:]})
+		}
+		if err == io.EOF {
+			return matches, nil
+		}
+	}
+}
+
+// lineCount returns the number of lines of a file, counting a last line without line terminator.
+func lineCount(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	last := byte('\n')
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte("\n"))
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		count++
+	}
+	return count, nil
+}
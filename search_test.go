@@ -0,0 +1,78 @@
+package expression_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestSearchFunctions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config"), "# settings\nlisten 8080\r\nserver_name example.com\nlisten 8443 ssl\n")
+	writeFile(t, filepath.Join(dir, "partial"), "one\ntwo")
+	writeFile(t, filepath.Join(dir, "empty"), "")
+	// The marker straddles the end of the first chunk read.
+	writeFile(t, filepath.Join(dir, "large"), strings.Repeat("x", 64*1024-3)+"MARKER"+strings.Repeat("y", 100))
+	data := map[string]interface{}{"dir": dir}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+	}{
+		{"fileContains", `fileContains(dir + "/config", "server_name example.com")`, true},
+		{"fileContains across lines", `fileContains(dir + "/config", "8080\r\nserver")`, true},
+		{"fileContains missing", `fileContains(dir + "/config", "listen 80\n")`, false},
+		{"fileContains across chunks", `fileContains(dir + "/large", "MARKER")`, true},
+		{"fileContains empty string", `fileContains(dir + "/empty", "")`, true},
+		{"grepFile lines", `map(grepFile(dir + "/config", "^listen"), .line)`, []interface{}{2, 4}},
+		{"grepFile text", `grepFile(dir + "/config", "^listen")[0].text`, "listen 8080"},
+		{"grepFile groups", `map(grepFile(dir + "/config", "^listen (\\d+)( ssl)?"), .groups)`, []interface{}{
+			[]string{"8080", ""}, []string{"8443", " ssl"},
+		}},
+		{"grepFile no match", `len(grepFile(dir + "/config", "^location"))`, 0},
+		{"grepFile last line without terminator", `grepFile(dir + "/partial", "^t")[0].line`, 2},
+		{"lineCount", `lineCount(dir + "/config")`, 4},
+		{"lineCount last line without terminator", `lineCount(dir + "/partial")`, 2},
+		{"lineCount empty", `lineCount(dir + "/empty")`, 0},
+		{"lineCount single line", `lineCount(dir + "/large")`, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.Evaluate(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestSearchFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"invalid pattern", `grepFile("file", "(")`, "grepFile() invalid pattern"},
+		{"missing file", `fileContains("/non/existing/file", "x")`, "no such file"},
+		{"missing argument", `fileContains("file")`, "fileContains() takes exactly 2 arguments"},
+		{"wrong type", `grepFile("file", 1)`, "grepFile() requires string arguments"},
+		{"lineCount missing file", `lineCount("/non/existing/file")`, "no such file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := expression.Evaluate(test.expr, nil)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
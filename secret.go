@@ -0,0 +1,298 @@
+package expression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secret values in output.
+const redacted = "***"
+
+// Secret is a sensitive string, such as a token, set in the data built by BuildData or NewData. Expressions
+// use it like a string: it can be compared, concatenated and passed to commands. Occurrences of its value are
+// redacted as `***` in EvaluateString results, rendered templates, error messages, audit events, recorded
+// bundles and command output streamed to handlers and writers. Evaluate returns strings containing secrets
+// as Secret values.
+//
+// Redaction replaces the exact value of the secret, so values derived from it are not redacted: `upper(token)`,
+// `split(token, "-")`, a substring or an encoding of the secret are output as is. Expressions handling secrets
+// should only pass them along, to commands or in concatenations.
+//
+// Secrets are only revealed by Reveal, or in expressions by the `reveal` function enabled by
+// WithSecretReveal.
+type Secret struct {
+	value string
+}
+
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// Reveal returns the value of the secret.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+func (Secret) String() string {
+	return redacted
+}
+
+func (Secret) GoString() string {
+	return redacted
+}
+
+// Format redacts the secret with every fmt verb.
+func (Secret) Format(f fmt.State, verb rune) {
+	if verb == 'q' {
+		fmt.Fprintf(f, "%q", redacted)
+		return
+	}
+	_, _ = io.WriteString(f, redacted)
+}
+
+// MarshalText redacts the secret when encoded as JSON or YAML.
+func (Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// WithSecretEnv marks the environment variables with names matching the patterns (such as `*_TOKEN`) as
+// secrets: their values are redacted from output like Secret values.
+func WithSecretEnv(patterns ...string) Option {
+	return func(s *session) {
+		s.secretEnv = append(s.secretEnv, patterns...)
+	}
+}
+
+// WithSecretReveal enables the `reveal` function, which marks a value as safe to output even though it
+// contains secrets, for the evaluation or the template execution calling it.
+func WithSecretReveal() Option {
+	return func(s *session) {
+		s.secretReveal = true
+	}
+}
+
+// registerSecrets collects the secrets of the variables and of the environment, and the variables holding
+// secrets with their values unwrapped for evaluations.
+func (s *session) registerSecrets(vars map[string]interface{}) {
+	values := make(map[string]bool)
+	for k, v := range vars {
+		if unwrapped, found := unwrapSecrets(v, values); found {
+			if s.secretVars == nil {
+				s.secretVars = make(map[string]interface{})
+			}
+			s.secretVars[k] = unwrapped
+		}
+	}
+	for k, v := range s.env {
+		if v != "" && envAllowed(k, s.secretEnv) {
+			values[v] = true
+		}
+	}
+
+	for value := range values {
+		s.secrets = append(s.secrets, value)
+	}
+	// Longer secrets first, so that secrets containing others are redacted as a whole.
+	sort.Slice(s.secrets, func(i, j int) bool {
+		if len(s.secrets[i]) != len(s.secrets[j]) {
+			return len(s.secrets[i]) > len(s.secrets[j])
+		}
+		return s.secrets[i] < s.secrets[j]
+	})
+}
+
+// unwrapSecrets returns a copy of value with its secrets replaced by their values, and whether it holds
+// any. The values of the secrets are added to values.
+func unwrapSecrets(value interface{}, values map[string]bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case Secret:
+		if v.value != "" {
+			values[v.value] = true
+		}
+		return v.value, true
+	case *Secret:
+		if v == nil {
+			return value, false
+		}
+		return unwrapSecrets(*v, values)
+	case map[string]interface{}:
+		var unwrapped map[string]interface{}
+		for k, item := range v {
+			if u, found := unwrapSecrets(item, values); found {
+				if unwrapped == nil {
+					unwrapped = make(map[string]interface{}, len(v))
+					for k2, item2 := range v {
+						unwrapped[k2] = item2
+					}
+				}
+				unwrapped[k] = u
+			}
+		}
+		if unwrapped == nil {
+			return value, false
+		}
+		return unwrapped, true
+	case []interface{}:
+		var unwrapped []interface{}
+		for i, item := range v {
+			if u, found := unwrapSecrets(item, values); found {
+				if unwrapped == nil {
+					unwrapped = append([]interface{}(nil), v...)
+				}
+				unwrapped[i] = u
+			}
+		}
+		if unwrapped == nil {
+			return value, false
+		}
+		return unwrapped, true
+	default:
+		return value, false
+	}
+}
+
+// unwrapSecretVars replaces the variables of the data holding secrets with their unwrapped values, so that
+// expressions handle secrets as plain strings. Variables replaced by other values, such as template
+// variables, are kept.
+func (s *session) unwrapSecretVars(data map[string]interface{}) {
+	for k, unwrapped := range s.secretVars {
+		if v, ok := data[k]; ok && containsSecret(v) {
+			data[k] = unwrapped
+		}
+	}
+}
+
+// containsSecret reports whether a value holds a Secret.
+func containsSecret(value interface{}) bool {
+	_, found := unwrapSecrets(value, make(map[string]bool))
+	return found
+}
+
+// redact replaces the secrets in a string.
+func (s *session) redact(str string) string {
+	return s.redactExcept(str, nil)
+}
+
+func (s *session) redactExcept(str string, revealed map[string]bool) string {
+	if s == nil {
+		return str
+	}
+	for _, secret := range s.secrets {
+		if !revealed[secret] && strings.Contains(str, secret) {
+			str = strings.ReplaceAll(str, secret, redacted)
+		}
+	}
+	return str
+}
+
+// evaluation holds the secrets revealed by an evaluation, or by the execution of a template.
+type evaluation struct {
+	s        *session
+	mu       sync.Mutex
+	revealed map[string]bool
+}
+
+// newEvaluation returns the state of an evaluation, or nil when there are no secrets to redact.
+func (s *session) newEvaluation() *evaluation {
+	if s == nil || len(s.secrets) == 0 {
+		return nil
+	}
+	return &evaluation{s: s, revealed: make(map[string]bool)}
+}
+
+// reveal marks the secrets contained in a value as safe to output.
+func (e *evaluation) reveal(value interface{}) interface{} {
+	if e == nil {
+		return value
+	}
+	str := fmt.Sprintf("%v", value)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, secret := range e.s.secrets {
+		if strings.Contains(str, secret) {
+			e.revealed[secret] = true
+		}
+	}
+	return value
+}
+
+// redact replaces the secrets that were not revealed in a string.
+func (e *evaluation) redact(str string) string {
+	if e == nil {
+		return str
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.s.redactExcept(str, e.revealed)
+}
+
+// redactError redacts the message of an error, keeping the original error for errors.Is and errors.As.
+func (e *evaluation) redactError(err error) error {
+	if err == nil || e == nil {
+		return err
+	}
+	message := e.redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{message: message, err: err}
+}
+
+// wrapSecret returns strings holding secrets that were not revealed as Secret values.
+func (e *evaluation) wrapSecret(value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok || e == nil || e.redact(str) == str {
+		return value
+	}
+	return NewSecret(str)
+}
+
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactingWriter redacts the secrets of the lines written to a writer. Lines are buffered until complete, so
+// that secrets split across writes are redacted too.
+type redactingWriter struct {
+	s   *session
+	w   io.Writer
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	i := bytes.LastIndexByte(w.buf.Bytes(), '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(w.w, w.s.redact(string(w.buf.Next(i+1)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush writes the remaining incomplete line, if any.
+func (w *redactingWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() > 0 {
+		_, _ = io.WriteString(w.w, w.s.redact(w.buf.String()))
+		w.buf.Reset()
+	}
+}
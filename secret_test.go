@@ -0,0 +1,136 @@
+package expression_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jahvon/expression"
+)
+
+func TestSecretRedaction(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	hook := &testAuditHook{}
+	data, err := expression.BuildDataWithOptions(context.Background(),
+		map[string]string{"API_TOKEN": "env-token-value", "NAME": "world"},
+		[]expression.Option{
+			expression.WithSecretEnv("*_TOKEN"),
+			expression.WithAuditHook(hook),
+			expression.WithOutputHandler(func(_ expression.CommandInfo, _ expression.OutputStream, line string) {
+				mu.Lock()
+				defer mu.Unlock()
+				lines = append(lines, line)
+			}),
+		},
+		"token", expression.NewSecret("s3cr3t-value"),
+		"db", map[string]interface{}{"password": expression.NewSecret("db-password")},
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{"secret variable", `token`, "***"},
+		{"concatenation", `"Bearer " + token`, "Bearer ***"},
+		{"nested secret", `db.password`, "***"},
+		{"secret environment variable", `env.API_TOKEN`, "***"},
+		{"comparison", `token == "s3cr3t-value"`, "true"},
+		{"other variable", `env.NAME`, "world"},
+		{"command argument", `$("echo " + token)`, "***"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := expression.EvaluateString(test.expr, data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+
+	result, err := expression.Evaluate(`"Bearer " + token`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	secret, ok := result.(expression.Secret)
+	if !ok || secret.Reveal() != "Bearer s3cr3t-value" {
+		t.Errorf("expected a secret holding the value, got %#v", result)
+	}
+	if printed := fmt.Sprintf("%v %s %q %+v", secret, secret, secret, secret); strings.Contains(printed, "s3cr3t") {
+		t.Errorf("expected the secret to be redacted when printed, got %q", printed)
+	}
+
+	_, err = expression.Evaluate(`$("echo " + token + " >&2; exit 1")`, data)
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") || !strings.Contains(err.Error(), "***") {
+		t.Errorf("expected a redacted error, got %v", err)
+	}
+
+	for _, line := range lines {
+		if strings.Contains(line, "s3cr3t") {
+			t.Errorf("expected redacted command output, got %q", line)
+		}
+	}
+	for _, event := range hook.events {
+		if strings.Contains(event.Target, "s3cr3t") || strings.Contains(event.Expression, "s3cr3t") {
+			t.Errorf("expected a redacted audit event, got %+v", event)
+		}
+	}
+}
+
+func TestSecretTemplate(t *testing.T) {
+	data, err := expression.NewData(context.Background(),
+		expression.WithVars(map[string]interface{}{
+			"token":  expression.NewSecret("s3cr3t-value"),
+			"public": expression.NewSecret("public-value"),
+		}),
+		expression.WithSecretReveal(),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tmpl := expression.NewTemplate("test", data)
+	if err := tmpl.Parse(`token={{token}} public={{reveal(public)}}` +
+		`{{if token == "s3cr3t-value"}} match{{end}}`); err != nil {
+		t.Fatalf("expected no error parsing, got %v", err)
+	}
+	result, err := tmpl.ExecuteToString()
+	if err != nil {
+		t.Fatalf("expected no error executing, got %v", err)
+	}
+	expected := "token=*** public=public-value match"
+	if result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	revealed, err := expression.EvaluateString(`reveal(token)`, data)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if revealed != "s3cr3t-value" {
+		t.Errorf("expected the revealed secret, got %q", revealed)
+	}
+}
+
+func TestSecretRevealDisabled(t *testing.T) {
+	data, err := expression.NewData(context.Background(),
+		expression.WithVars(map[string]interface{}{"token": expression.NewSecret("s3cr3t-value")}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = expression.Evaluate(`reveal(token)`, data)
+	if err == nil {
+		t.Error("expected an error calling reveal without WithSecretReveal")
+	}
+}
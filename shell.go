@@ -0,0 +1,381 @@
+package expression
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// command is a shell command requested by an expression.
+type command struct {
+	text string
+	// input is the explicit stdin of the command, if any.
+	input *string
+	// fn and expression are the built-in function and expression requesting the command.
+	fn         string
+	expression string
+	// prefetched holds the results prefetched for the template execution requesting the command, if any.
+	prefetched prefetchedResults
+}
+
+// commandResult holds the captured streams and exit code of an executed command.
+type commandResult struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// output returns the text returned to the expression for the result of a command.
+// Failed commands only return their stderr.
+func (r commandResult) output(err error) string {
+	if err != nil {
+		return r.stderr
+	}
+	output := r.stdout
+	if r.stderr != "" {
+		output += "\n" + r.stderr
+	}
+	return strings.TrimSpace(output)
+}
+
+// runCommand executes a command on behalf of the built-in function fn and returns its trimmed output.
+func (s *session) runCommand(
+	fn, ex, text string, cmdOpts []map[string]interface{}, prefetched prefetchedResults,
+) (string, error) {
+	c, err := newCommand(fn, text, cmdOpts)
+	c.expression, c.prefetched = ex, prefetched
+	if err != nil {
+		return "", err
+	}
+	result, err := s.execute(c)
+	output := result.output(err)
+	if err != nil {
+		return "", fmt.Errorf("command failed: %v, output: %s", err, output)
+	}
+	return output, nil
+}
+
+// runParsedCommand executes a command on behalf of the built-in function fn and parses its stdout.
+func (s *session) runParsedCommand(
+	fn, ex, text string, cmdOpts []map[string]interface{}, prefetched prefetchedResults,
+	parse func(stdout string) (interface{}, error),
+) (interface{}, error) {
+	c, err := newCommand(fn, text, cmdOpts)
+	c.expression, c.prefetched = ex, prefetched
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.execute(c)
+	if err != nil {
+		return nil, fmt.Errorf("command failed: %v, output: %s", err, result.output(err))
+	}
+	parsed, err := parse(result.stdout)
+	if err != nil {
+		return nil, fmt.Errorf("%s() unable to parse output of %q: %w, output: %s", fn, text, err, outputSnippet(result.stdout))
+	}
+	return parsed, nil
+}
+
+// outputParsers are the parsers of the command functions returning the parsed stdout of a command.
+var outputParsers = map[string]func(stdout string) (interface{}, error){
+	"$json": func(stdout string) (interface{}, error) {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(stdout), &parsed); err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	},
+	"$yaml": func(stdout string) (interface{}, error) {
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(stdout), &parsed); err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	},
+	"$lines": func(stdout string) (interface{}, error) {
+		lines := make([]string, 0)
+		trimmed := strings.TrimRight(stdout, "\r\n")
+		if trimmed == "" {
+			return lines, nil
+		}
+		for _, line := range strings.Split(trimmed, "\n") {
+			lines = append(lines, strings.TrimSuffix(line, "\r"))
+		}
+		return lines, nil
+	},
+	"$fields": func(stdout string) (interface{}, error) {
+		return append(make([]string, 0), strings.Fields(stdout)...), nil
+	},
+}
+
+// isCommandFunction reports whether name is a built-in function taking a shell command.
+func isCommandFunction(name string) bool {
+	_, ok := outputParsers[name]
+	return name == "$" || ok
+}
+
+// outputSnippet returns the beginning of a command output for error messages.
+func outputSnippet(output string) string {
+	const maxLen = 200
+	if len(output) > maxLen {
+		return fmt.Sprintf("%q...", output[:maxLen])
+	}
+	return fmt.Sprintf("%q", output)
+}
+
+// execute runs a command, or serves it from the prefetched results or the replay bundle. Executions are
+// audited, and recorded when recording.
+func (s *session) execute(c command) (commandResult, error) {
+	if prefetched, ok := c.prefetched[commandKey(c.text, c.input)]; ok {
+		return prefetched.result, prefetched.err
+	}
+
+	var result commandResult
+	event := AuditEvent{Kind: AuditCommand, Operation: c.fn, Target: c.text, Expression: c.expression}
+	err := s.audit(event, func() (int, error) {
+		var err error
+		result, err = s.executeCommand(c)
+		return len(result.stdout) + len(result.stderr), err
+	})
+	return result, err
+}
+
+func (s *session) executeCommand(c command) (commandResult, error) {
+	if s.replay != nil {
+		return s.replay.command(s.redactCommand(c))
+	}
+
+	var stdin io.Reader
+	if c.input != nil {
+		stdin = strings.NewReader(*c.input)
+	} else if s.inheritStdin {
+		stdin = os.Stdin
+	}
+	var runnerOpts []interp.RunnerOption
+	if s.portableBuiltins {
+		runnerOpts = append(runnerOpts, interp.ExecHandlers(portableBuiltinsHandler))
+	}
+	info := CommandInfo{ID: s.commandID.Add(1), Command: c.text}
+	stdout, stderr, flush := s.outputWriters(info)
+	result, err := execute(s.ctx, c.text, s.commandEnv(), stdin, stdout, stderr, runnerOpts...)
+	flush()
+	if s.recorder != nil {
+		s.recordCommand(c, result, err)
+	}
+	return result, err
+}
+
+// newCommand builds a command from its text and the optional options map of a command call.
+func newCommand(fn, text string, cmdOpts []map[string]interface{}) (command, error) {
+	c := command{text: text, fn: fn}
+	if len(cmdOpts) > 1 {
+		return c, fmt.Errorf("%s() takes at most 1 options argument", fn)
+	}
+	if len(cmdOpts) == 0 {
+		return c, nil
+	}
+
+	for key, value := range cmdOpts[0] {
+		switch key {
+		case "input":
+			switch v := value.(type) {
+			case string:
+				c.input = &v
+			case []byte:
+				input := string(v)
+				c.input = &input
+			case nil:
+				// An explicit nil input is an empty stdin, even when the process's stdin is inherited.
+				empty := ""
+				c.input = &empty
+			default:
+				return c, fmt.Errorf("%s() input must be a string, got %T", fn, value)
+			}
+		default:
+			return c, fmt.Errorf("%s() unknown option %q", fn, key)
+		}
+	}
+	return c, nil
+}
+
+// argvCommand builds a shell command from a program name and its arguments, quoting each of them
+// so that they are passed to the program verbatim. The parameters of a `run` call are an optional
+// argument list followed by an optional options map.
+func argvCommand(name string, params []interface{}) (string, []map[string]interface{}, error) {
+	var cmdOpts []map[string]interface{}
+	if len(params) > 0 {
+		if m, ok := params[len(params)-1].(map[string]interface{}); ok {
+			cmdOpts = append(cmdOpts, m)
+			params = params[:len(params)-1]
+		}
+	}
+	if len(params) > 1 {
+		return "", nil, fmt.Errorf("run() takes a name, an optional argument list and an optional options map")
+	}
+
+	argv := []string{name}
+	if len(params) == 1 {
+		switch args := params[0].(type) {
+		case []string:
+			argv = append(argv, args...)
+		case []interface{}:
+			for _, arg := range args {
+				switch arg.(type) {
+				case string, int, int64, float64, uint, uint64, bool:
+					argv = append(argv, fmt.Sprintf("%v", arg))
+				default:
+					return "", nil, fmt.Errorf("run() arguments must be scalar values, got %T", arg)
+				}
+			}
+		default:
+			return "", nil, fmt.Errorf("run() arguments must be a list, got %T", params[0])
+		}
+	}
+
+	quoted := make([]string, 0, len(argv))
+	for _, arg := range argv {
+		q, err := shellQuote(arg)
+		if err != nil {
+			return "", nil, fmt.Errorf("run() %w", err)
+		}
+		quoted = append(quoted, q)
+	}
+	return strings.Join(quoted, " "), cmdOpts, nil
+}
+
+// shellQuote quotes a string so that the shell interpreter reads it as a single literal word.
+func shellQuote(s string) (string, error) {
+	quoted, err := syntax.Quote(s, syntax.LangBash)
+	if err != nil {
+		return "", fmt.Errorf("unable to quote %q - %w", s, err)
+	}
+	return quoted, nil
+}
+
+// execute runs a command with the shell interpreter and captures its output. The output is also copied
+// to the stdout and stderr writers while the command runs, when they are not nil.
+func execute(
+	ctx context.Context, cmd string, envList []string, stdin io.Reader, stdout, stderr io.Writer,
+	opts ...interp.RunnerOption,
+) (commandResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parser := syntax.NewParser()
+	reader := strings.NewReader(strings.TrimSpace(cmd))
+	prog, err := parser.Parse(reader, "")
+	if err != nil {
+		return commandResult{}, fmt.Errorf("unable to parse command - %w", err)
+	}
+
+	stdOutBuffer := &strings.Builder{}
+	stdErrBuffer := &strings.Builder{}
+	var stdOutWriter, stdErrWriter io.Writer = stdOutBuffer, stdErrBuffer
+	if stdout != nil {
+		stdOutWriter = io.MultiWriter(stdOutBuffer, stdout)
+	}
+	if stderr != nil {
+		stdErrWriter = io.MultiWriter(stdErrBuffer, stderr)
+	}
+
+	runner, err := interp.New(append([]interp.RunnerOption{
+		interp.Env(expand.ListEnviron(envList...)),
+		interp.StdIO(
+			stdin,
+			stdOutWriter,
+			stdErrWriter,
+		),
+	}, opts...)...)
+	if err != nil {
+		return commandResult{}, fmt.Errorf("unable to create runner - %w", err)
+	}
+
+	err = runner.Run(ctx, prog)
+	result := commandResult{stdout: stdOutBuffer.String(), stderr: stdErrBuffer.String()}
+	if err != nil {
+		var exitStatus interp.ExitStatus
+		if errors.As(err, &exitStatus) {
+			result.exitCode = int(exitStatus)
+			return result, fmt.Errorf("command exited with non-zero status %w", exitStatus)
+		}
+		result.exitCode = -1
+		return result, fmt.Errorf("encountered an error executing command - %w", err)
+	}
+	return result, nil
+}
+
+// EnvMode controls which variables of the host environment are passed to commands.
+// Variables of the env map always take precedence over host variables with the same name.
+type EnvMode int
+
+const (
+	// InheritEnv passes the whole host environment to commands. This is the default.
+	InheritEnv EnvMode = iota
+	// InheritAllowedEnv only passes the host variables matching the allowlist.
+	InheritAllowedEnv
+	// CleanEnv only passes the variables of the env map. Note that commands can then only be found
+	// when the env map contains PATH.
+	CleanEnv
+)
+
+// WithEnvMode sets which host environment variables are visible to commands. With InheritAllowedEnv,
+// the allowlist contains variable names or patterns such as "LC_*" (see path.Match).
+func WithEnvMode(mode EnvMode, allowlist ...string) Option {
+	return func(s *session) {
+		s.envMode = mode
+		s.envAllowlist = allowlist
+	}
+}
+
+// commandEnv returns the environment of commands: the host variables selected by the env mode,
+// overridden by the variables of the env map.
+func (s *session) commandEnv() []string {
+	var envList []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if _, ok := s.env[key]; ok || !s.hostEnvVisible(key) {
+			continue
+		}
+		envList = append(envList, kv)
+	}
+	return append(envList, environmentToSlice(s.env)...)
+}
+
+// hostEnvVisible reports whether a host environment variable is visible to commands with the env mode.
+func (s *session) hostEnvVisible(key string) bool {
+	switch s.envMode {
+	case CleanEnv:
+		return false
+	case InheritAllowedEnv:
+		return envAllowed(key, s.envAllowlist)
+	default:
+		return true
+	}
+}
+
+// lookupHostEnv looks up a host environment variable visible to commands.
+func (s *session) lookupHostEnv(key string) (string, bool) {
+	if !s.hostEnvVisible(key) {
+		return "", false
+	}
+	return os.LookupEnv(key)
+}
+
+func envAllowed(key string, allowlist []string) bool {
+	for _, pattern := range allowlist {
+		if matched, err := path.Match(pattern, key); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package expression
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// OutputStream identifies the stream a command wrote its output to.
+type OutputStream int
+
+const (
+	Stdout OutputStream = iota
+	Stderr
+)
+
+func (s OutputStream) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// CommandInfo identifies a command run by the built-in functions.
+type CommandInfo struct {
+	// ID is unique among the commands run with the same data.
+	ID      int64
+	Command string
+}
+
+// OutputHandler is called with each line written by a command while it runs, without the line terminator.
+// It may be called concurrently for different streams and commands.
+type OutputHandler func(cmd CommandInfo, stream OutputStream, line string)
+
+// WithOutputHandler streams the output of commands line by line to the handler. Commands still return
+// their full output to the expression.
+func WithOutputHandler(handler OutputHandler) Option {
+	return func(s *session) {
+		s.outputHandler = handler
+	}
+}
+
+// WithOutputWriters copies the output of commands to the given writers while they run. Either writer
+// may be nil. Writes of concurrent commands are serialized but may interleave.
+func WithOutputWriters(stdout, stderr io.Writer) Option {
+	return func(s *session) {
+		if stdout != nil {
+			s.stdoutWriter = &syncWriter{w: stdout}
+		}
+		if stderr != nil {
+			s.stderrWriter = &syncWriter{w: stderr}
+		}
+	}
+}
+
+// outputWriters returns the writers the output of a command is copied to while it runs, and a function
+// flushing the last incomplete lines once it completes.
+func (s *session) outputWriters(info CommandInfo) (io.Writer, io.Writer, func()) {
+	var stdout, stderr []io.Writer
+	if s.stdoutWriter != nil {
+		stdout = append(stdout, s.stdoutWriter)
+	}
+	if s.stderrWriter != nil {
+		stderr = append(stderr, s.stderrWriter)
+	}
+
+	var flushes []func()
+	if len(s.secrets) > 0 {
+		for _, writers := range []*[]io.Writer{&stdout, &stderr} {
+			if len(*writers) > 0 {
+				redacting := &redactingWriter{s: s, w: (*writers)[0]}
+				*writers = []io.Writer{redacting}
+				flushes = append(flushes, redacting.flush)
+			}
+		}
+	}
+
+	if s.outputHandler != nil {
+		stdoutLines := &lineWriter{fn: func(line string) { s.outputHandler(info, Stdout, s.redact(line)) }}
+		stderrLines := &lineWriter{fn: func(line string) { s.outputHandler(info, Stderr, s.redact(line)) }}
+		stdout = append(stdout, stdoutLines)
+		stderr = append(stderr, stderrLines)
+		flushes = append(flushes, stdoutLines.flush, stderrLines.flush)
+	}
+	flush := func() {
+		for _, f := range flushes {
+			f()
+		}
+	}
+	return multiWriter(stdout), multiWriter(stderr), flush
+}
+
+func multiWriter(writers []io.Writer) io.Writer {
+	if len(writers) == 0 {
+		return nil
+	}
+	return io.MultiWriter(writers...)
+}
+
+// lineWriter calls fn for each complete line written to it.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	fn  func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(bytes.TrimSuffix(w.buf.Next(i + 1)[:i], []byte("\r")))
+		w.fn(line)
+	}
+}
+
+// flush calls fn with the remaining incomplete line, if any.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() > 0 {
+		w.fn(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+// syncWriter serializes the writes to a writer shared by concurrent commands.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
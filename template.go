@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"text/template"
@@ -23,6 +24,13 @@ type Template struct {
 	tmpl         *template.Template
 	exprCache    map[string]*vm.Program
 	templateVars map[string]interface{}
+	expressions  []string
+	// evaluation redacts the secrets of the data while the template executes.
+	evaluation *evaluation
+	// prefetched holds the results of Prefetch until the next execution, and executionPrefetched those
+	// used while the template executes.
+	prefetched          prefetchedResults
+	executionPrefetched prefetchedResults
 }
 
 func NewTemplate(name string, data Data) *Template {
@@ -36,6 +44,7 @@ func NewTemplate(name string, data Data) *Template {
 
 func (t *Template) Parse(text string) error {
 	t.text = text
+	t.expressions = nil
 	processed := t.preProcessExpressions(text)
 
 	tmpl := template.New(t.name).Funcs(template.FuncMap{
@@ -61,11 +70,50 @@ func (t *Template) ParseFile(file string) error {
 	return t.Parse(string(text))
 }
 
+// Prefetch concurrently runs the commands of all `$` calls with a literal command in the parsed template,
+// so that executing the template does not wait on each of them in turn. Commands are prefetched regardless of
+// the branches taken when executing the template, so they should be free of side effects. Prefetch does
+// nothing when the template data was not built with BuildData.
+//
+// The results are only used by the next execution of the template: later executions, and other evaluations
+// of the data, run the commands again. Call Prefetch before each execution to prefetch them again.
+func (t *Template) Prefetch() error {
+	if t.tmpl == nil {
+		return fmt.Errorf("template not parsed")
+	}
+	s := sessionFromData(t.data)
+	if s == nil {
+		return nil
+	}
+	prefetched, err := s.prefetch(t.expressions)
+	if err != nil {
+		return err
+	}
+	t.prefetched = prefetched
+	return nil
+}
+
 func (t *Template) Execute(wr io.Writer) error {
 	if t.tmpl == nil {
 		return fmt.Errorf("template not parsed")
 	}
-	return t.tmpl.Execute(wr, t.data)
+	t.executionPrefetched, t.prefetched = t.prefetched, nil
+	defer func() { t.executionPrefetched = nil }()
+
+	ev := sessionFromData(t.data).newEvaluation()
+	if ev == nil {
+		return t.tmpl.Execute(wr, t.data)
+	}
+
+	// The output is redacted once complete, revealing the secrets revealed by any of its expressions.
+	t.evaluation = ev
+	defer func() { t.evaluation = nil }()
+	var buf bytes.Buffer
+	err := t.tmpl.Execute(&buf, t.data)
+	if _, writeErr := io.WriteString(wr, ev.redact(buf.String())); err == nil {
+		err = writeErr
+	}
+	return ev.redactError(err)
 }
 
 func (t *Template) ExecuteToString() (string, error) {
@@ -142,7 +190,7 @@ func (t *Template) processAction(action string, contextDepth int) string {
 		if t.isGoSyntax(condition, contextDepth) {
 			return "if " + condition
 		}
-		return "if exprBool `" + condition + "`"
+		return "if " + t.exprCall("exprBool", condition)
 	}
 
 	if strings.HasPrefix(action, "else if ") {
@@ -152,7 +200,7 @@ func (t *Template) processAction(action string, contextDepth int) string {
 		if t.isGoSyntax(condition, contextDepth) {
 			return "else if " + condition
 		}
-		return "else if exprBool `" + condition + "`"
+		return "else if " + t.exprCall("exprBool", condition)
 	}
 
 	// With and range structures
@@ -163,7 +211,7 @@ func (t *Template) processAction(action string, contextDepth int) string {
 		if t.isGoSyntax(value, contextDepth) {
 			return "with " + value
 		}
-		return "with expr `" + value + "`"
+		return "with " + t.exprCall("expr", value)
 	}
 
 	if strings.HasPrefix(action, "range ") {
@@ -178,14 +226,14 @@ func (t *Template) processAction(action string, contextDepth int) string {
 				if t.isGoSyntax(e, contextDepth) {
 					return "range " + vars + " := " + e
 				}
-				return "range " + vars + " := expr `" + e + "`"
+				return "range " + vars + " := " + t.exprCall("expr", e)
 			}
 		}
 
 		if t.isGoSyntax(value, contextDepth) {
 			return "range " + value
 		}
-		return "range expr `" + value + "`"
+		return "range " + t.exprCall("expr", value)
 	}
 
 	// Variable assignment
@@ -198,7 +246,7 @@ func (t *Template) processAction(action string, contextDepth int) string {
 			if t.isGoSyntax(e, contextDepth) {
 				return fmt.Sprintf("%s := (setVar %q %s)", varName, strings.TrimPrefix(varName, "$"), e)
 			}
-			return fmt.Sprintf("%s := (setVar %q (expr `%s`))", varName, strings.TrimPrefix(varName, "$"), e)
+			return fmt.Sprintf("%s := (setVar %q (%s))", varName, strings.TrimPrefix(varName, "$"), t.exprCall("expr", e))
 		}
 	}
 
@@ -211,13 +259,26 @@ func (t *Template) processAction(action string, contextDepth int) string {
 	if t.isGoSyntax(action, contextDepth) {
 		return action
 	}
-	return "expr `" + action + "`"
+	return t.exprCall("expr", action)
+}
+
+// exprCall returns the template function call evaluating an expression, and keeps track of the expression.
+func (t *Template) exprCall(fn, expression string) string {
+	t.expressions = append(t.expressions, expression)
+	return fn + " `" + expression + "`"
 }
 
+// goVariablePattern matches template variables such as `$`, `$x` or `$.Field`, but not calls of the `$` function
+// or of its variants such as `$json`.
+var goVariablePattern = regexp.MustCompile(`\$\w*([^\w(]|$)`)
+
+// stringLiteralPattern matches quoted strings, whose content is ignored when looking for template variables.
+var stringLiteralPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+
 func (t *Template) isGoSyntax(expression string, contextDepth int) bool {
 	expression = strings.TrimSpace(expression)
 
-	if strings.Contains(expression, "$") {
+	if goVariablePattern.MatchString(stringLiteralPattern.ReplaceAllString(expression, `""`)) {
 		return true
 	}
 
@@ -233,13 +294,12 @@ func (t *Template) setTemplateVar(name string, value interface{}) interface{} {
 	return value
 }
 
-func (t *Template) compileExpr(expression string) (*vm.Program, error) {
+func (t *Template) compileExpr(expression string, env map[string]interface{}, opts []expr.Option) (*vm.Program, error) {
 	if node, ok := t.exprCache[expression]; ok {
 		return node, nil
 	}
 
-	env := t.createExprEnvironment()
-	compiled, err := expr.Compile(expression, expr.Env(env))
+	compiled, err := expr.Compile(expression, append(opts, expr.Env(env))...)
 	if err != nil {
 		return nil, err
 	}
@@ -270,12 +330,24 @@ func (t *Template) createExprEnvironment() map[string]interface{} {
 }
 
 func (t *Template) evalExpr(expression string) (interface{}, error) {
-	program, err := t.compileExpr(expression)
+	env := t.createExprEnvironment()
+	var opts []expr.Option
+	if s := sessionFromData(t.data); s != nil {
+		var err error
+		env, opts, err = s.forExpression(env, expression, t.evaluation)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating expression: %w", err)
+		}
+		if t.executionPrefetched != nil {
+			s.setCommandFunctions(env, expression, t.executionPrefetched)
+		}
+	}
+
+	program, err := t.compileExpr(expression, env, opts)
 	if err != nil {
 		return nil, fmt.Errorf("compiling expression: %w", err)
 	}
 
-	env := t.createExprEnvironment()
 	result, err := expr.Run(program, env)
 	if err != nil {
 		return nil, fmt.Errorf("evaluating expression: %w", err)
@@ -1,6 +1,9 @@
 package expression_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -418,6 +421,94 @@ Total tasks: {{ $taskCount }}`
 	})
 }
 
+func TestTemplateCommands(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "runs.log")
+	data, err := expression.BuildData(context.Background(), map[string]string{"LOG": logFile}, "name", "world")
+	if err != nil {
+		t.Fatalf("expected no error building data, got %v", err)
+	}
+	text := `{{ $("echo hello") }} {{ name }}: {{ if $("echo run >> $LOG && wc -l < $LOG") == "1" }}once{{ end }}`
+
+	t.Run("evaluates command calls", func(t *testing.T) {
+		tmpl := expression.NewTemplate("test", data)
+		if err := tmpl.Parse(`{{ $("echo hello") }} {{ $x := $("echo x") }}{{ $x }} {{ $lines("echo y")[0] }}`); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		result, err := tmpl.ExecuteToString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != "hello x y" {
+			t.Errorf("expected 'hello x y', got '%s'", result)
+		}
+	})
+
+	t.Run("reuses prefetched commands", func(t *testing.T) {
+		tmpl := expression.NewTemplate("test", data)
+		if err := tmpl.Parse(text); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := tmpl.Prefetch(); err != nil {
+			t.Fatalf("expected no error prefetching, got %v", err)
+		}
+		result, err := tmpl.ExecuteToString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != "hello world: once" {
+			t.Errorf("expected 'hello world: once', got '%s'", result)
+		}
+
+		runs, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatalf("failed to read log file: %v", err)
+		}
+		if strings.Count(string(runs), "run") != 1 {
+			t.Errorf("expected the command to run once, got %q", runs)
+		}
+	})
+
+	t.Run("uses prefetched commands for the next execution only", func(t *testing.T) {
+		countFile := filepath.Join(t.TempDir(), "count")
+		writeFile(t, countFile, "1")
+		data, err := expression.BuildData(context.Background(), map[string]string{"COUNT": countFile})
+		if err != nil {
+			t.Fatalf("expected no error building data, got %v", err)
+		}
+		tmpl := expression.NewTemplate("test", data)
+		if err := tmpl.Parse(`{{ $("cat $COUNT") }}`); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := tmpl.Prefetch(); err != nil {
+			t.Fatalf("expected no error prefetching, got %v", err)
+		}
+		writeFile(t, countFile, "2")
+
+		for _, expected := range []string{"1", "2"} {
+			result, err := tmpl.ExecuteToString()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != expected {
+				t.Errorf("expected '%s', got '%s'", expected, result)
+			}
+		}
+		if result, err := expression.EvaluateString(`$("cat $COUNT")`, data); err != nil || result != "2" {
+			t.Errorf("expected evaluations not to use prefetched results, got %q (%v)", result, err)
+		}
+	})
+
+	t.Run("prefetch without built data", func(t *testing.T) {
+		_, tmpl := setupTestData()
+		if err := tmpl.Parse("{{ os }}"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := tmpl.Prefetch(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
 func TestErrorHandling(t *testing.T) {
 	t.Run("handles invalid expressions", func(t *testing.T) {
 		_, tmpl := setupTestData()